@@ -0,0 +1,84 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/veteran-software/yourddo-api/shared/types"
+)
+
+// Error codes reported in the v2 schema
+const (
+	CodeConfigMissing         = "config_missing"
+	CodeDatacenterUnavailable = "datacenter_unavailable"
+	CodeDatacenterTimeout     = "datacenter_timeout"
+	CodeDatacenterTooLarge    = "datacenter_too_large"
+	CodeWorldUnavailable      = "world_unavailable"
+	CodeWorldTimeout          = "world_timeout"
+	CodeWorldTooLarge         = "world_too_large"
+	CodeInternal              = "internal_error"
+)
+
+var errDatacenterURLNotSet = errors.New("DATACENTER_URL environment variable is not set")
+
+// APIError attaches a stable code, and optionally the world it came from, to an error surfaced in a response.
+// Its message matches the plain error strings returned by the v1 API.
+type APIError struct {
+	Code  string
+	World string
+	URL   string
+	Err   error
+}
+
+func (e *APIError) Error() string {
+	if e.URL != "" {
+		return fmt.Sprintf("URL %s: %v", e.URL, e.Err)
+	}
+
+	return e.Err.Error()
+}
+
+func (e *APIError) Unwrap() error {
+	return e.Err
+}
+
+// datacenterErrorCode returns the code for a failed datacenter fetch.
+func datacenterErrorCode(err error) string {
+	switch {
+	case isTimeout(err):
+		return CodeDatacenterTimeout
+	case errors.Is(err, ErrUpstreamTooLarge):
+		return CodeDatacenterTooLarge
+	default:
+		return CodeDatacenterUnavailable
+	}
+}
+
+// worldErrorCode returns the code for a failed world status fetch.
+func worldErrorCode(err error) string {
+	switch {
+	case isTimeout(err):
+		return CodeWorldTimeout
+	case errors.Is(err, ErrUpstreamTooLarge):
+		return CodeWorldTooLarge
+	default:
+		return CodeWorldUnavailable
+	}
+}
+
+// toErrorInfo converts any error into its structured v2 representation.
+func toErrorInfo(err error) types.ErrorInfo {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return types.ErrorInfo{
+			Code:    apiErr.Code,
+			Message: apiErr.Err.Error(),
+			World:   apiErr.World,
+			URL:     apiErr.URL,
+		}
+	}
+
+	return types.ErrorInfo{
+		Code:    CodeInternal,
+		Message: err.Error(),
+	}
+}
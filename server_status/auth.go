@@ -0,0 +1,331 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/redis/go-redis/v9"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	apiKeyHeader     = "X-API-Key"
+	apiKeyQueryParam = "api_key"
+)
+
+// Usage tiers and their daily request quotas; 0 means unlimited.
+var tierQuotas = map[string]int64{
+	"free":     10_000,
+	"standard": 100_000,
+	"partner":  0,
+}
+
+// APIKey is a third-party consumer of the API. Only the SHA-256 hash of the key is stored.
+type APIKey struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	// Hash is the hex-encoded SHA-256 of the key.
+	Hash string `json:"hash"`
+	Tier string `json:"tier"`
+	// DailyQuota overrides the quota of Tier when positive.
+	DailyQuota int64 `json:"dailyQuota,omitempty"`
+	// AllowedOrigins lists the browser origins that may use the key, in the format of CORS_ALLOWED_ORIGINS. Requests
+	// without an Origin header, such as server-to-server calls, are always accepted.
+	AllowedOrigins []string `json:"allowedOrigins,omitempty"`
+	Disabled       bool     `json:"disabled,omitempty"`
+
+	origins *CORSPolicy
+}
+
+// Quota returns the number of requests the key may make per UTC day, or 0 when it is unlimited.
+func (k *APIKey) Quota() int64 {
+	if k.DailyQuota > 0 {
+		return k.DailyQuota
+	}
+
+	return tierQuotas[k.Tier]
+}
+
+// hashAPIKey returns the value stored in APIKey.Hash for key.
+func hashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// KeyStore looks up API keys. Lookup returns nil without an error for keys it does not know.
+type KeyStore interface {
+	Lookup(ctx context.Context, key string) (*APIKey, error)
+}
+
+// MemoryKeyStore holds a fixed set of keys.
+type MemoryKeyStore struct {
+	keys map[string]*APIKey
+}
+
+// NewMemoryKeyStore validates keys and indexes them by hash.
+func NewMemoryKeyStore(keys []APIKey) (*MemoryKeyStore, error) {
+	store := &MemoryKeyStore{keys: make(map[string]*APIKey, len(keys))}
+
+	for i := range keys {
+		key := keys[i]
+
+		if key.ID == "" {
+			return nil, fmt.Errorf("API key %d has no id", i)
+		}
+		if _, ok := tierQuotas[key.Tier]; !ok {
+			return nil, fmt.Errorf("API key %s has unknown tier %q", key.ID, key.Tier)
+		}
+
+		key.Hash = strings.ToLower(key.Hash)
+		if decoded, err := hex.DecodeString(key.Hash); err != nil || len(decoded) != sha256.Size {
+			return nil, fmt.Errorf("API key %s hash is not a hex-encoded SHA-256", key.ID)
+		}
+		if _, ok := store.keys[key.Hash]; ok {
+			return nil, fmt.Errorf("API key %s duplicates the hash of another key", key.ID)
+		}
+
+		key.origins = NewCORSPolicy(key.AllowedOrigins, false)
+		store.keys[key.Hash] = &key
+	}
+
+	return store, nil
+}
+
+func (s *MemoryKeyStore) Lookup(_ context.Context, key string) (*APIKey, error) {
+	return s.keys[hashAPIKey(key)], nil
+}
+
+// loadAPIKeys reads a JSON array of APIKey into a store. Returns nil when path is empty.
+func loadAPIKeys(path string) (*MemoryKeyStore, error) {
+	if path == "" {
+		return nil, nil
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading API_KEYS_PATH: %w", err)
+	}
+
+	var keys []APIKey
+	if err := json.Unmarshal(content, &keys); err != nil {
+		return nil, fmt.Errorf("error decoding API keys from %s: %w", path, err)
+	}
+
+	store, err := NewMemoryKeyStore(keys)
+	if err != nil {
+		return nil, fmt.Errorf("error loading API keys from %s: %w", path, err)
+	}
+
+	return store, nil
+}
+
+// Authenticator checks API keys. Without a store every request is served anonymously. With one, a presented key must
+// be valid; requests without a key are served unless Required is set. The Origin header can be forged, so it never
+// stands in for a key, not even for our own sites: browser clients use a publishable key restricted to their
+// AllowedOrigins, and a key restricted that way is refused from every other origin.
+type Authenticator struct {
+	store    KeyStore
+	required bool
+	quotas   QuotaStore
+	now      func() time.Time
+}
+
+// NewAuthenticator returns an authenticator counting quotas in memory.
+func NewAuthenticator(store KeyStore, required bool) *Authenticator {
+	return &Authenticator{store: store, required: required, quotas: NewMemoryQuotaStore(), now: time.Now}
+}
+
+// authenticatorFromConfig returns an authenticator checking the keys loaded with the configuration, or one that lets
+// every request through when no keys file is set. Quotas are counted in client, the shared Redis server, when set.
+func authenticatorFromConfig(c AuthConfig, client *redis.Client) *Authenticator {
+	var store KeyStore
+	if c.Keys != nil {
+		store = c.Keys
+	}
+
+	a := NewAuthenticator(store, c.Required)
+	if client != nil {
+		a.quotas = NewRedisQuotaStore(client)
+	}
+
+	return a
+}
+
+var auth *Authenticator
+
+// Enabled reports whether API keys are checked at all.
+func (a *Authenticator) Enabled() bool {
+	return a.store != nil
+}
+
+// requestAPIKey returns the key sent in the X-API-Key header or the api_key query parameter.
+func requestAPIKey(req events.APIGatewayProxyRequest) string {
+	if key := requestHeader(req, apiKeyHeader); key != "" {
+		return key
+	}
+
+	return req.QueryStringParameters[apiKeyQueryParam]
+}
+
+// authorization is the outcome of an accepted request: the caller's key, nil for anonymous callers, and the headers
+// to add to the response.
+type authorization struct {
+	key     *APIKey
+	headers map[string]string
+}
+
+// authorize decides whether req may be served, returning the response to send instead when it may not.
+func (a *Authenticator) authorize(ctx context.Context, req events.APIGatewayProxyRequest) (*authorization, *events.APIGatewayProxyResponse) {
+	if !a.Enabled() {
+		return &authorization{headers: map[string]string{}}, nil
+	}
+
+	origin := requestHeader(req, "Origin")
+
+	presented := requestAPIKey(req)
+	if presented == "" {
+		if a.required {
+			return nil, authError(req, http.StatusUnauthorized, "Unauthorized: an API key is required", nil)
+		}
+
+		return &authorization{headers: map[string]string{}}, nil
+	}
+
+	key, err := a.store.Lookup(ctx, presented)
+	if err != nil {
+		loggerFromContext(ctx).Error("API key lookup failed", "error", err)
+		resp := internalServerError()
+		return nil, &resp
+	}
+
+	if key == nil || key.Disabled {
+		return nil, authError(req, http.StatusUnauthorized, "Unauthorized: invalid API key", nil)
+	}
+
+	if origin != "" && len(key.AllowedOrigins) > 0 && !key.origins.Allowed(origin) {
+		return nil, authError(req, http.StatusForbidden, "Forbidden: origin not allowed for this API key", nil)
+	}
+
+	headers := map[string]string{}
+	if origin != "" && key.origins.Allowed(origin) {
+		headers["Access-Control-Allow-Origin"] = origin
+		headers["Access-Control-Allow-Credentials"] = "true"
+	}
+
+	return &authorization{key: key, headers: headers}, nil
+}
+
+// takeQuota counts an authorized request against its key's daily quota, adding the quota headers to granted and
+// returning the response to send instead when the quota is used up. Errors from the store let the request through.
+func (a *Authenticator) takeQuota(ctx context.Context, req events.APIGatewayProxyRequest, granted *authorization) *events.APIGatewayProxyResponse {
+	if granted.key == nil {
+		return nil
+	}
+
+	now := a.now()
+	limit := granted.key.Quota()
+	used, ok, err := a.quotas.Take(ctx, granted.key.ID, limit, now)
+	if err != nil {
+		loggerFromContext(ctx).Warn("quota check failed, allowing request", "api_key_id", granted.key.ID, "error", err)
+		return nil
+	}
+
+	if limit > 0 {
+		reset := quotaDay(now).Add(24 * time.Hour)
+		granted.headers["X-Quota-Limit"] = strconv.FormatInt(limit, 10)
+		granted.headers["X-Quota-Remaining"] = strconv.FormatInt(max(limit-used, 0), 10)
+		granted.headers["X-Quota-Reset"] = strconv.FormatInt(reset.Unix(), 10)
+		exposeHeaders(granted.headers, "X-Quota-Limit", "X-Quota-Remaining", "X-Quota-Reset")
+
+		if !ok {
+			granted.headers["Retry-After"] = strconv.Itoa(int(reset.Sub(now).Seconds()) + 1)
+			return authError(req, http.StatusTooManyRequests, "Too Many Requests: daily quota exceeded", granted.headers)
+		}
+	}
+
+	loggerFromContext(ctx).Debug("API key accepted", "api_key_id", granted.key.ID, "quota_used", used)
+
+	return nil
+}
+
+// authError builds a plain text error response carrying extra headers.
+func authError(req events.APIGatewayProxyRequest, status int, body string, extra map[string]string) *events.APIGatewayProxyResponse {
+	headers := map[string]string{"Content-Type": "text/plain; charset=utf-8"}
+	applyCORS(req, headers)
+	for name, value := range extra {
+		headers[name] = value
+	}
+
+	return &events.APIGatewayProxyResponse{StatusCode: status, Headers: headers, Body: body}
+}
+
+// serveAuthorized calls serve when req is authorized, within its rate limit and within its key's quota, and adds the
+// resulting headers to its response. Rate limiting comes first, so throttled requests do not use up the quota.
+func serveAuthorized(ctx context.Context, req events.APIGatewayProxyRequest, serve func(context.Context) events.APIGatewayProxyResponse) events.APIGatewayProxyResponse {
+	return cacheByKey(req, authorizeAndServe(ctx, req, serve))
+}
+
+func authorizeAndServe(ctx context.Context, req events.APIGatewayProxyRequest, serve func(context.Context) events.APIGatewayProxyResponse) events.APIGatewayProxyResponse {
+	granted, denied := auth.authorize(ctx, req)
+	if denied != nil {
+		return *denied
+	}
+
+	if denied := limiter.allow(ctx, req, granted); denied != nil {
+		return *denied
+	}
+
+	if denied := auth.takeQuota(ctx, req, granted); denied != nil {
+		return *denied
+	}
+
+	if granted.key != nil {
+		ctx = contextWithLogger(ctx, loggerFromContext(ctx).With("api_key_id", granted.key.ID))
+	}
+
+	return withHeaders(serve(ctx), granted.headers)
+}
+
+// cacheByKey keeps shared caches from handing one caller's response to another while API keys are checked. Responses
+// to keyed requests carry the key's quota and may only be cached by the caller; the others vary on the key header, so
+// a cached anonymous response is never served to a keyed request. A CDN must also include the api_key query parameter
+// in its cache key.
+func cacheByKey(req events.APIGatewayProxyRequest, resp events.APIGatewayProxyResponse) events.APIGatewayProxyResponse {
+	if !auth.Enabled() {
+		return resp
+	}
+
+	if resp.Headers == nil {
+		resp.Headers = make(map[string]string)
+	}
+	addVary(resp.Headers, apiKeyHeader)
+
+	if requestAPIKey(req) != "" {
+		if resp.Headers["Cache-Control"] != "" {
+			resp.Headers["Cache-Control"] = privateCacheControl()
+		} else {
+			resp.Headers["Cache-Control"] = "no-store"
+		}
+	}
+
+	return resp
+}
+
+// withHeaders adds headers to resp.
+func withHeaders(resp events.APIGatewayProxyResponse, headers map[string]string) events.APIGatewayProxyResponse {
+	if len(headers) > 0 && resp.Headers == nil {
+		resp.Headers = make(map[string]string, len(headers))
+	}
+	for name, value := range headers {
+		resp.Headers[name] = value
+	}
+
+	return resp
+}
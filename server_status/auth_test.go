@@ -0,0 +1,323 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/aws/aws-lambda-go/events"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// useAuthenticator replaces auth for the rest of the test.
+func useAuthenticator(t *testing.T, a *Authenticator) {
+	previous := auth
+	auth = a
+	t.Cleanup(func() {
+		auth = previous
+	})
+}
+
+// testKeyStore returns a store holding the keys "free-key", "limited-key", "origin-key" and "disabled-key".
+func testKeyStore(t *testing.T) *MemoryKeyStore {
+	store, err := NewMemoryKeyStore([]APIKey{
+		{ID: "free", Hash: hashAPIKey("free-key"), Tier: "free"},
+		{ID: "limited", Hash: hashAPIKey("limited-key"), Tier: "free", DailyQuota: 2},
+		{ID: "origin", Hash: hashAPIKey("origin-key"), Tier: "partner", AllowedOrigins: []string{"https://ddotools.example"}},
+		{ID: "disabled", Hash: hashAPIKey("disabled-key"), Tier: "free", Disabled: true},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return store
+}
+
+func TestNewMemoryKeyStore(t *testing.T) {
+	hash := hashAPIKey("key")
+
+	tests := []struct {
+		name    string
+		keys    []APIKey
+		wantErr string
+	}{
+		{name: "valid", keys: []APIKey{{ID: "a", Hash: strings.ToUpper(hash), Tier: "standard"}}},
+		{name: "missing id", keys: []APIKey{{Hash: hash, Tier: "free"}}, wantErr: "no id"},
+		{name: "unknown tier", keys: []APIKey{{ID: "a", Hash: hash, Tier: "gold"}}, wantErr: "unknown tier"},
+		{name: "plain key instead of hash", keys: []APIKey{{ID: "a", Hash: "key", Tier: "free"}}, wantErr: "SHA-256"},
+		{
+			name:    "duplicate hash",
+			keys:    []APIKey{{ID: "a", Hash: hash, Tier: "free"}, {ID: "b", Hash: hash, Tier: "free"}},
+			wantErr: "duplicates",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store, err := NewMemoryKeyStore(tt.keys)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("NewMemoryKeyStore() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("NewMemoryKeyStore() error = %v", err)
+			}
+
+			key, _ := store.Lookup(context.Background(), "key")
+			if key == nil || key.ID != "a" {
+				t.Errorf("Lookup() = %+v, want key a", key)
+			}
+		})
+	}
+}
+
+func TestLoadAPIKeys(t *testing.T) {
+	content := `[{"id": "free", "name": "DDO Tools", "hash": "` + hashAPIKey("free-key") + `", "tier": "free"}]`
+
+	store, err := loadAPIKeys(writeConfigFile(t, "keys.json", content))
+	if err != nil {
+		t.Fatalf("loadAPIKeys() error = %v", err)
+	}
+
+	key, err := store.Lookup(context.Background(), "free-key")
+	if err != nil {
+		t.Fatalf("Lookup() error = %v", err)
+	}
+	if key == nil || key.Name != "DDO Tools" || key.Quota() != tierQuotas["free"] {
+		t.Errorf("Lookup() = %+v", key)
+	}
+
+	if key, _ := store.Lookup(context.Background(), "other-key"); key != nil {
+		t.Errorf("Lookup() of an unknown key = %+v, want nil", key)
+	}
+
+	if store, err := loadAPIKeys(""); store != nil || err != nil {
+		t.Errorf("loadAPIKeys(\"\") = %v, %v, want nil and no error", store, err)
+	}
+}
+
+func TestLoadConfigAPIKeys(t *testing.T) {
+	env := map[string]string{"DATACENTER_URL": "https://ddo.com/datacenter"}
+
+	env["API_KEYS_PATH"] = writeConfigFile(t, "keys.json", `[{"id": "a", "hash": "`+hashAPIKey("key")+`", "tier": "free"}]`)
+	got, err := LoadConfig(context.Background(), lookupMap(env))
+	if err != nil {
+		t.Fatalf("LoadConfig() error = %v", err)
+	}
+	if key, _ := got.Auth.Keys.Lookup(context.Background(), "key"); key == nil || key.ID != "a" {
+		t.Errorf("Auth.Keys lookup = %+v, want key a", key)
+	}
+
+	// A broken keys file must stop the cold start instead of failing every keyed request
+	for name, path := range map[string]string{
+		"malformed":    writeConfigFile(t, "broken.json", `[{"id": `),
+		"unknown tier": writeConfigFile(t, "tier.json", `[{"id": "a", "hash": "`+hashAPIKey("key")+`", "tier": "gold"}]`),
+		"missing":      filepath.Join(t.TempDir(), "missing.json"),
+	} {
+		t.Run(name, func(t *testing.T) {
+			env["API_KEYS_PATH"] = path
+			if _, err := LoadConfig(context.Background(), lookupMap(env)); err == nil {
+				t.Error("LoadConfig() succeeded")
+			}
+		})
+	}
+}
+
+func TestAuthorizeFeedRequests(t *testing.T) {
+	tests := []struct {
+		name       string
+		required   bool
+		headers    map[string]string
+		query      map[string]string
+		wantStatus int
+		wantOrigin string
+	}{
+		{name: "anonymous when optional", wantStatus: http.StatusOK},
+		{name: "anonymous when required", required: true, wantStatus: http.StatusUnauthorized},
+		{
+			name:       "anonymous first-party origin when required",
+			required:   true,
+			headers:    map[string]string{"Origin": "https://yourddo.com"},
+			wantStatus: http.StatusUnauthorized,
+			wantOrigin: "https://yourddo.com",
+		},
+		{name: "key in header", required: true, headers: map[string]string{"x-api-key": "free-key"}, wantStatus: http.StatusOK},
+		{name: "key in query", required: true, query: map[string]string{"api_key": "free-key"}, wantStatus: http.StatusOK},
+		{name: "unknown key", headers: map[string]string{"X-API-Key": "wrong"}, wantStatus: http.StatusUnauthorized},
+		{name: "disabled key", headers: map[string]string{"X-API-Key": "disabled-key"}, wantStatus: http.StatusUnauthorized},
+		{
+			name:       "key from its allowed origin",
+			headers:    map[string]string{"X-API-Key": "origin-key", "Origin": "https://ddotools.example"},
+			wantStatus: http.StatusOK,
+			wantOrigin: "https://ddotools.example",
+		},
+		{
+			name:       "key from another origin",
+			headers:    map[string]string{"X-API-Key": "origin-key", "Origin": "https://example.com"},
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "key from a first-party origin it is not allowed on",
+			headers:    map[string]string{"X-API-Key": "origin-key", "Origin": "https://yourddo.com"},
+			wantStatus: http.StatusForbidden,
+			wantOrigin: "https://yourddo.com",
+		},
+		{
+			name:       "key without an origin",
+			headers:    map[string]string{"X-API-Key": "origin-key"},
+			wantStatus: http.StatusOK,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useAuthenticator(t, NewAuthenticator(testKeyStore(t), tt.required))
+
+			got, err := handleRequest(context.Background(), events.APIGatewayProxyRequest{
+				Path:                  "/server_status/feed.atom",
+				Headers:               tt.headers,
+				QueryStringParameters: tt.query,
+			})
+			if err != nil {
+				t.Fatalf("handleRequest() error = %v", err)
+			}
+
+			if got.StatusCode != tt.wantStatus {
+				t.Errorf("status = %v, want %v: %s", got.StatusCode, tt.wantStatus, got.Body)
+			}
+			if got.Headers["Access-Control-Allow-Origin"] != tt.wantOrigin {
+				t.Errorf("Access-Control-Allow-Origin = %q, want %q", got.Headers["Access-Control-Allow-Origin"], tt.wantOrigin)
+			}
+		})
+	}
+}
+
+func TestAuthorizeEnforcesQuota(t *testing.T) {
+	a := NewAuthenticator(testKeyStore(t), false)
+	a.now = func() time.Time {
+		return time.Date(2024, 1, 1, 23, 0, 0, 0, time.UTC)
+	}
+	useAuthenticator(t, a)
+
+	req := events.APIGatewayProxyRequest{
+		Path:    "/server_status/feed.rss",
+		Headers: map[string]string{"X-API-Key": "limited-key"},
+	}
+
+	for _, want := range []struct {
+		status    int
+		remaining string
+	}{
+		{status: http.StatusOK, remaining: "1"},
+		{status: http.StatusOK, remaining: "0"},
+		{status: http.StatusTooManyRequests, remaining: "0"},
+	} {
+		got, err := handleRequest(context.Background(), req)
+		if err != nil {
+			t.Fatalf("handleRequest() error = %v", err)
+		}
+
+		if got.StatusCode != want.status {
+			t.Errorf("status = %v, want %v", got.StatusCode, want.status)
+		}
+		if got.Headers["X-Quota-Limit"] != "2" || got.Headers["X-Quota-Remaining"] != want.remaining {
+			t.Errorf("quota headers = %s/%s, want 2/%s", got.Headers["X-Quota-Limit"], got.Headers["X-Quota-Remaining"], want.remaining)
+		}
+		if want.status == http.StatusTooManyRequests && got.Headers["Retry-After"] != "3601" {
+			t.Errorf("Retry-After = %q, want 3601", got.Headers["Retry-After"])
+		}
+	}
+}
+
+func TestKeyedResponsesAreNotShared(t *testing.T) {
+	statusServer := newXMLTestServer(statusResponse)
+	defer statusServer.Close()
+
+	datacenterServer := newXMLTestServer(fmt.Sprintf(dcResponse, statusServer.URL))
+	defer datacenterServer.Close()
+
+	cleanup := setupEnv(t, datacenterServer.URL)
+	defer cleanup()
+
+	useAuthenticator(t, NewAuthenticator(testKeyStore(t), false))
+
+	tests := []struct {
+		name             string
+		headers          map[string]string
+		query            map[string]string
+		wantCacheControl string
+	}{
+		{name: "key in header", headers: map[string]string{"X-API-Key": "free-key"}, wantCacheControl: "private, max-age=30"},
+		{name: "key in query", query: map[string]string{"api_key": "free-key"}, wantCacheControl: "private, max-age=30"},
+		{name: "anonymous", wantCacheControl: "public, max-age=30, stale-while-revalidate=30"},
+	}
+
+	for _, path := range []string{"/v2/server_status", "/server_status/feed.atom", "/server_status/TestWorld/badge.svg"} {
+		for _, tt := range tests {
+			t.Run(path+" "+tt.name, func(t *testing.T) {
+				got, err := handleRequest(context.Background(), events.APIGatewayProxyRequest{
+					Path:                  path,
+					Headers:               tt.headers,
+					QueryStringParameters: tt.query,
+				})
+				if err != nil {
+					t.Fatalf("handleRequest() error = %v", err)
+				}
+
+				if got.StatusCode != http.StatusOK {
+					t.Fatalf("status = %v, want %v", got.StatusCode, http.StatusOK)
+				}
+				if got.Headers["Cache-Control"] != tt.wantCacheControl {
+					t.Errorf("Cache-Control = %q, want %q", got.Headers["Cache-Control"], tt.wantCacheControl)
+				}
+				if !strings.Contains(got.Headers["Vary"], apiKeyHeader) {
+					t.Errorf("Vary = %q, want it to include %s", got.Headers["Vary"], apiKeyHeader)
+				}
+			})
+		}
+	}
+}
+
+func TestKeyedErrorsAreNotStored(t *testing.T) {
+	useAuthenticator(t, NewAuthenticator(testKeyStore(t), false))
+
+	got, err := handleRequest(context.Background(), events.APIGatewayProxyRequest{
+		Path:    "/server_status/feed.atom",
+		Headers: map[string]string{"X-API-Key": "wrong"},
+	})
+	if err != nil {
+		t.Fatalf("handleRequest() error = %v", err)
+	}
+
+	if got.StatusCode != http.StatusUnauthorized || got.Headers["Cache-Control"] != "no-store" {
+		t.Errorf("status = %v, Cache-Control = %q, want 401 and no-store", got.StatusCode, got.Headers["Cache-Control"])
+	}
+}
+
+func TestPreflightAllowsAPIKeyFromAnyOrigin(t *testing.T) {
+	useAuthenticator(t, NewAuthenticator(testKeyStore(t), false))
+
+	got, err := handleRequest(context.Background(), events.APIGatewayProxyRequest{
+		HTTPMethod: http.MethodOptions,
+		Path:       "/v2/server_status",
+		Headers: map[string]string{
+			"Origin":                         "https://ddotools.example",
+			"Access-Control-Request-Method":  "GET",
+			"Access-Control-Request-Headers": "x-api-key",
+		},
+	})
+	if err != nil {
+		t.Fatalf("handleRequest() error = %v", err)
+	}
+
+	if got.Headers["Access-Control-Allow-Origin"] != "https://ddotools.example" {
+		t.Errorf("Access-Control-Allow-Origin = %q", got.Headers["Access-Control-Allow-Origin"])
+	}
+	if got.Headers["Access-Control-Allow-Headers"] != "x-api-key" {
+		t.Errorf("Access-Control-Allow-Headers = %q", got.Headers["Access-Control-Allow-Headers"])
+	}
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/veteran-software/yourddo-api/shared/types"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+type badgeStyle string
+
+const (
+	badgeFlat        badgeStyle = "flat"
+	badgeFlatSquare  badgeStyle = "flat-square"
+	badgeForTheBadge badgeStyle = "for-the-badge"
+)
+
+var badgePath = regexp.MustCompile(`^/server_status/([^/]+)/badge\.svg$`)
+
+// badgeColors is the value background used for each state, matching the shields.io palette.
+var badgeColors = map[types.ServerState]string{
+	types.StateOnline:  "#4c1",
+	types.StateOffline: "#e05d44",
+	types.StateError:   "#fe7d37",
+	types.StateUnknown: "#9f9f9f",
+}
+
+// badgeWorldFromPath returns the world name requested by a path such as "/server_status/Argonnessen/badge.svg".
+func badgeWorldFromPath(path string) (string, bool) {
+	match := badgePath.FindStringSubmatch(path)
+	if match == nil {
+		return "", false
+	}
+
+	world, err := url.PathUnescape(match[1])
+	if err != nil {
+		return "", false
+	}
+
+	return world, true
+}
+
+// findServer looks a world up by name or display name, ignoring case and spaces so "/thelanis/" and "/Thelanis/" both
+// match.
+func findServer(servers []*types.ServerInfo, name string) *types.ServerInfo {
+	normalize := func(s string) string {
+		return strings.ToLower(strings.Join(strings.Fields(s), ""))
+	}
+
+	want := normalize(name)
+	for _, server := range servers {
+		if normalize(server.Name) == want || normalize(server.CommonName) == want ||
+			(server.DisplayName != "" && normalize(server.DisplayName) == want) {
+			return server
+		}
+	}
+
+	return nil
+}
+
+// textWidth approximates the rendered width of text in 11px Verdana, which is what shields-style badges use.
+func textWidth(text string, style badgeStyle) int {
+	perChar := 7.0
+	if style == badgeForTheBadge {
+		perChar = 8.5
+	}
+
+	return int(float64(len([]rune(text)))*perChar) + 10
+}
+
+// renderBadge renders a two-part "label | message" SVG badge.
+func renderBadge(label, message, color string, style badgeStyle) []byte {
+	if style == badgeForTheBadge {
+		label, message = strings.ToUpper(label), strings.ToUpper(message)
+	}
+
+	height, radius := 20, 3
+	switch style {
+	case badgeFlatSquare:
+		radius = 0
+	case badgeForTheBadge:
+		height, radius = 28, 0
+	}
+
+	labelWidth := textWidth(label, style)
+	messageWidth := textWidth(message, style)
+	width := labelWidth + messageWidth
+	textY := height/2 + 4
+
+	escape := func(s string) string {
+		var buf bytes.Buffer
+		_ = xml.EscapeText(&buf, []byte(s))
+		return buf.String()
+	}
+
+	var buf bytes.Buffer
+	_, _ = fmt.Fprintf(&buf, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" role="img" aria-label="%s: %s">`,
+		width, height, escape(label), escape(message))
+	_, _ = fmt.Fprintf(&buf, `<title>%s: %s</title>`, escape(label), escape(message))
+	_, _ = fmt.Fprintf(&buf, `<clipPath id="r"><rect width="%d" height="%d" rx="%d" fill="#fff"/></clipPath>`, width, height, radius)
+	buf.WriteString(`<g clip-path="url(#r)">`)
+	_, _ = fmt.Fprintf(&buf, `<rect width="%d" height="%d" fill="#555"/>`, labelWidth, height)
+	_, _ = fmt.Fprintf(&buf, `<rect x="%d" width="%d" height="%d" fill="%s"/>`, labelWidth, messageWidth, height, color)
+	buf.WriteString(`</g>`)
+	buf.WriteString(`<g fill="#fff" text-anchor="middle" font-family="Verdana,Geneva,DejaVu Sans,sans-serif" font-size="11">`)
+	_, _ = fmt.Fprintf(&buf, `<text x="%d" y="%d">%s</text>`, labelWidth/2, textY, escape(label))
+	_, _ = fmt.Fprintf(&buf, `<text x="%d" y="%d">%s</text>`, labelWidth+messageWidth/2, textY, escape(message))
+	buf.WriteString(`</g></svg>`)
+
+	return buf.Bytes()
+}
+
+// serveBadge responds with the status badge of a single world. ?label= replaces the world name on the left and
+// ?style= selects flat (default), flat-square or for-the-badge.
+func serveBadge(ctx context.Context, req events.APIGatewayProxyRequest, world string) events.APIGatewayProxyResponse {
+	style := badgeStyle(strings.ToLower(req.QueryStringParameters["style"]))
+	switch style {
+	case "":
+		style = badgeFlat
+	case badgeFlat, badgeFlatSquare, badgeForTheBadge:
+	default:
+		return events.APIGatewayProxyResponse{
+			StatusCode: http.StatusBadRequest,
+			Headers:    map[string]string{"Content-Type": "text/plain; charset=utf-8"},
+			Body:       "Bad Request: style must be flat, flat-square or for-the-badge",
+		}
+	}
+
+	snap := fetchSnapshot(ctx)
+
+	server := findServer(snap.Servers, world)
+	if server == nil {
+		return events.APIGatewayProxyResponse{
+			StatusCode: http.StatusNotFound,
+			Headers:    map[string]string{"Content-Type": "text/plain; charset=utf-8"},
+			Body:       "Not Found: unknown world",
+		}
+	}
+
+	label := req.QueryStringParameters["label"]
+	if label == "" {
+		label = displayName(server)
+	}
+
+	svg := renderBadge(label, stateLabel(server.State), badgeColors[server.State], style)
+
+	sum := sha256.Sum256(svg)
+	etag := fmt.Sprintf(`"%s"`, hex.EncodeToString(sum[:16]))
+
+	headers := map[string]string{
+		"Access-Control-Allow-Origin": "*",
+		"Cache-Control":               cacheControl(),
+		"ETag":                        etag,
+	}
+
+	if inm := requestHeader(req, "If-None-Match"); inm != "" && etagMatches(inm, etag) {
+		return events.APIGatewayProxyResponse{
+			StatusCode: http.StatusNotModified,
+			Headers:    headers,
+		}
+	}
+
+	headers["Content-Type"] = "image/svg+xml; charset=utf-8"
+
+	return events.APIGatewayProxyResponse{
+		StatusCode: http.StatusOK,
+		Headers:    headers,
+		Body:       string(svg),
+	}
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/veteran-software/yourddo-api/shared/types"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestBadgeWorldFromPath(t *testing.T) {
+	tests := []struct {
+		path   string
+		want   string
+		wantOK bool
+	}{
+		{path: "/server_status/Argonnessen/badge.svg", want: "Argonnessen", wantOK: true},
+		{path: "/server_status/Thrane%20Test/badge.svg", want: "Thrane Test", wantOK: true},
+		{path: "/server_status/badge.svg", wantOK: false},
+		{path: "/server_status/Argonnessen/badge.png", wantOK: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			got, ok := badgeWorldFromPath(tt.path)
+			if got != tt.want || ok != tt.wantOK {
+				t.Errorf("badgeWorldFromPath(%q) = %q, %v, want %q, %v", tt.path, got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestFindServer(t *testing.T) {
+	servers := []*types.ServerInfo{
+		{Name: "Argonnessen", CommonName: "Argonnessen"},
+		{Name: "ThraneTest", CommonName: "Thrane Test"},
+		{Name: "Cannith", CommonName: "Cannith", DisplayName: "Cannith Hardcore"},
+	}
+
+	if got := findServer(servers, "argonnessen"); got != servers[0] {
+		t.Errorf("findServer() case-insensitive lookup = %v", got)
+	}
+	if got := findServer(servers, "Thrane Test"); got != servers[1] {
+		t.Errorf("findServer() lookup by common name = %v", got)
+	}
+	if got := findServer(servers, "Cannith Hardcore"); got != servers[2] {
+		t.Errorf("findServer() lookup by display name = %v", got)
+	}
+	if got := findServer(servers, "Sarlona"); got != nil {
+		t.Errorf("findServer() unknown world = %v, want nil", got)
+	}
+}
+
+func TestRenderBadge(t *testing.T) {
+	for _, style := range []badgeStyle{badgeFlat, badgeFlatSquare, badgeForTheBadge} {
+		t.Run(string(style), func(t *testing.T) {
+			svg := renderBadge(`Guild "<Hall>"`, "Online", badgeColors[types.StateOnline], style)
+
+			if err := xml.Unmarshal(svg, new(struct{})); err != nil {
+				t.Fatalf("badge is not well-formed XML: %v\n%s", err, svg)
+			}
+			if !strings.Contains(string(svg), badgeColors[types.StateOnline]) {
+				t.Error("badge does not use the state color")
+			}
+			if strings.Contains(string(svg), "<Hall>") {
+				t.Error("label was not escaped")
+			}
+		})
+	}
+}
+
+func TestHandleRequestBadge(t *testing.T) {
+	statusServer := newXMLTestServer(statusResponse)
+	defer statusServer.Close()
+
+	datacenterServer := newXMLTestServer(fmt.Sprintf(dcResponse, statusServer.URL))
+	defer datacenterServer.Close()
+
+	useOverrides(t, `{"TestWorld": {"displayName": "Test World"}}`)
+
+	cleanup := setupEnv(t, datacenterServer.URL)
+	defer cleanup()
+
+	tests := []struct {
+		name       string
+		path       string
+		query      map[string]string
+		wantStatus int
+		wantBody   string
+	}{
+		{name: "online world", path: "/server_status/TestWorld/badge.svg", wantStatus: http.StatusOK, wantBody: ">Online<"},
+		{name: "display name label", path: "/server_status/TestWorld/badge.svg", wantStatus: http.StatusOK, wantBody: ">Test World<"},
+		{
+			name:       "custom label and style",
+			path:       "/server_status/testworld/badge.svg",
+			query:      map[string]string{"label": "My Server", "style": "for-the-badge"},
+			wantStatus: http.StatusOK,
+			wantBody:   ">MY SERVER<",
+		},
+		{name: "unknown world", path: "/server_status/Nowhere/badge.svg", wantStatus: http.StatusNotFound},
+		{
+			name:       "unknown style",
+			path:       "/server_status/TestWorld/badge.svg",
+			query:      map[string]string{"style": "3d"},
+			wantStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := handleRequest(context.Background(), events.APIGatewayProxyRequest{
+				Path:                  tt.path,
+				QueryStringParameters: tt.query,
+			})
+			if err != nil {
+				t.Fatalf("handleRequest() error = %v", err)
+			}
+
+			if got.StatusCode != tt.wantStatus {
+				t.Fatalf("status = %v, want %v", got.StatusCode, tt.wantStatus)
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+
+			if got.Headers["Content-Type"] != "image/svg+xml; charset=utf-8" {
+				t.Errorf("Content-Type = %q", got.Headers["Content-Type"])
+			}
+			if got.Headers["Cache-Control"] == "" || got.Headers["ETag"] == "" {
+				t.Errorf("cache headers missing: %v", got.Headers)
+			}
+			if !strings.Contains(got.Body, tt.wantBody) {
+				t.Errorf("badge does not contain %q:\n%s", tt.wantBody, got.Body)
+			}
+		})
+	}
+}
+
+func TestHandleRequestBadgeRequiresKey(t *testing.T) {
+	statusServer := newXMLTestServer(statusResponse)
+	defer statusServer.Close()
+
+	datacenterServer := newXMLTestServer(fmt.Sprintf(dcResponse, statusServer.URL))
+	defer datacenterServer.Close()
+
+	cleanup := setupEnv(t, datacenterServer.URL)
+	defer cleanup()
+
+	useAuthenticator(t, NewAuthenticator(testKeyStore(t), true))
+
+	tests := []struct {
+		name       string
+		query      map[string]string
+		wantStatus int
+	}{
+		{name: "without a key", wantStatus: http.StatusUnauthorized},
+		{name: "key in query", query: map[string]string{"api_key": "free-key"}, wantStatus: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := handleRequest(context.Background(), events.APIGatewayProxyRequest{
+				Path:                  "/server_status/TestWorld/badge.svg",
+				QueryStringParameters: tt.query,
+			})
+			if err != nil {
+				t.Fatalf("handleRequest() error = %v", err)
+			}
+
+			if got.StatusCode != tt.wantStatus {
+				t.Errorf("status = %v, want %v", got.StatusCode, tt.wantStatus)
+			}
+		})
+	}
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/veteran-software/yourddo-api/shared/types"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultCacheMaxAge               = 30
+	defaultCacheStaleWhileRevalidate = 30
+)
+
+// contentTracker remembers when the content served in each version and format last changed, so Last-Modified only
+// moves when that content does.
+type contentTracker struct {
+	mu      sync.Mutex
+	entries map[string]trackedContent
+}
+
+type trackedContent struct {
+	hash         string
+	lastModified time.Time
+}
+
+var tracker = &contentTracker{}
+
+// observe records the hash of the content just built for key and returns the time that content was first seen.
+func (c *contentTracker) observe(key, hash string, at time.Time) time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.entries == nil {
+		c.entries = make(map[string]trackedContent)
+	}
+
+	entry, ok := c.entries[key]
+	if !ok || entry.hash != hash {
+		entry = trackedContent{hash: hash, lastModified: at.UTC().Truncate(time.Second)}
+		c.entries[key] = entry
+	}
+
+	return entry.lastModified
+}
+
+// contentHash returns a hash of the body served for a snapshot in a given API version and format. The snapshot is
+// rendered the same way as the response, with only the timestamps that change on every poll cleared, so any other
+// change to the body, such as queue data, staleness or world overrides, changes the hash.
+func contentHash(version apiVersion, format outputFormat, snap *snapshot) (string, error) {
+	stable := *snap
+	stable.GeneratedAt = time.Time{}
+	stable.Datacenter.AgeSeconds = nil
+	stable.Servers = make([]*types.ServerInfo, 0, len(snap.Servers))
+	for _, server := range snap.Servers {
+		server := *server
+		server.CheckedAt = time.Time{}
+		stable.Servers = append(stable.Servers, &server)
+	}
+
+	content, err := renderResponse(version, format, &stable)
+	if err != nil {
+		return "", fmt.Errorf("error hashing response: %w", err)
+	}
+
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:16]), nil
+}
+
+// weakETag builds the ETag for a content hash served in a given API version and format. It is weak because the hash
+// leaves out the per-poll timestamps of the v2 body.
+func weakETag(version apiVersion, format outputFormat, hash string) string {
+	return fmt.Sprintf(`W/"v%d-%s-%s"`, version, format, hash)
+}
+
+// cacheControl builds the Cache-Control header from the cache configuration. Its Control setting, when set, is used
+// verbatim instead.
+func cacheControl() string {
+	if cfg.Cache.Control != "" {
+		return cfg.Cache.Control
+	}
+
+	directives := []string{
+		"public",
+		fmt.Sprintf("max-age=%d", int(cfg.Cache.MaxAge.Seconds())),
+	}
+
+	if swr := int(cfg.Cache.StaleWhileRevalidate.Seconds()); swr > 0 {
+		directives = append(directives, fmt.Sprintf("stale-while-revalidate=%d", swr))
+	}
+
+	if sie := int(cfg.Cache.StaleIfError.Seconds()); sie > 0 {
+		directives = append(directives, fmt.Sprintf("stale-if-error=%d", sie))
+	}
+
+	return strings.Join(directives, ", ")
+}
+
+// privateCacheControl is the Cache-Control header of responses to keyed requests, which only the caller may cache.
+func privateCacheControl() string {
+	return fmt.Sprintf("private, max-age=%d", int(cfg.Cache.MaxAge.Seconds()))
+}
+
+// requestHeader looks up a request header case-insensitively, as API Gateway passes header names through unchanged.
+func requestHeader(req events.APIGatewayProxyRequest, name string) string {
+	for key, value := range req.Headers {
+		if strings.EqualFold(key, name) {
+			return value
+		}
+	}
+
+	for key, values := range req.MultiValueHeaders {
+		if strings.EqualFold(key, name) && len(values) > 0 {
+			return strings.Join(values, ",")
+		}
+	}
+
+	return ""
+}
+
+// notModified evaluates If-None-Match and If-Modified-Since. If-None-Match takes precedence when both are present.
+func notModified(req events.APIGatewayProxyRequest, etag string, lastModified time.Time) bool {
+	if inm := requestHeader(req, "If-None-Match"); inm != "" {
+		return etagMatches(inm, etag)
+	}
+
+	if ims := requestHeader(req, "If-Modified-Since"); ims != "" {
+		since, err := http.ParseTime(ims)
+		if err != nil {
+			return false
+		}
+
+		return !lastModified.After(since)
+	}
+
+	return false
+}
+
+// etagMatches compares an If-None-Match header against an ETag using weak comparison.
+func etagMatches(header, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/veteran-software/yourddo-api/shared/types"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestContentTrackerObserve(t *testing.T) {
+	c := &contentTracker{}
+	first := time.Date(2024, 1, 1, 12, 0, 0, 500, time.UTC)
+
+	if got := c.observe("v1-json", "a", first); !got.Equal(first.Truncate(time.Second)) {
+		t.Errorf("observe() = %v, want %v", got, first.Truncate(time.Second))
+	}
+
+	if got := c.observe("v1-json", "a", first.Add(time.Minute)); !got.Equal(first.Truncate(time.Second)) {
+		t.Errorf("observe() with unchanged content = %v, want %v", got, first.Truncate(time.Second))
+	}
+
+	other := first.Add(90 * time.Second)
+	if got := c.observe("v2-json", "x", other); !got.Equal(other.Truncate(time.Second)) {
+		t.Errorf("observe() for another version = %v, want %v", got, other.Truncate(time.Second))
+	}
+	if got := c.observe("v1-json", "a", other); !got.Equal(first.Truncate(time.Second)) {
+		t.Errorf("observe() after another version = %v, want %v", got, first.Truncate(time.Second))
+	}
+
+	changed := first.Add(2 * time.Minute)
+	if got := c.observe("v1-json", "b", changed); !got.Equal(changed.Truncate(time.Second)) {
+		t.Errorf("observe() with changed content = %v, want %v", got, changed.Truncate(time.Second))
+	}
+}
+
+func TestContentHash(t *testing.T) {
+	hash := func(version apiVersion, format outputFormat, change func(snap *snapshot)) string {
+		snap := goldenSnapshot()
+		change(snap)
+
+		got, err := contentHash(version, format, snap)
+		if err != nil {
+			t.Fatalf("contentHash() error = %v", err)
+		}
+		return got
+	}
+
+	unchanged := func(*snapshot) {}
+	base := hash(apiV2, formatJSON, unchanged)
+
+	nextPoll := hash(apiV2, formatJSON, func(snap *snapshot) {
+		age := 60.0
+		snap.GeneratedAt = snap.GeneratedAt.Add(time.Minute)
+		snap.Datacenter.AgeSeconds = &age
+		for _, server := range snap.Servers {
+			server.CheckedAt = server.CheckedAt.Add(time.Minute)
+		}
+	})
+	if nextPoll != base {
+		t.Error("contentHash() changed with the poll timestamps only")
+	}
+
+	changes := map[string]func(snap *snapshot){
+		"queue":        func(snap *snapshot) { snap.Servers[0].Queue.Depth++ },
+		"stale":        func(snap *snapshot) { snap.Datacenter.Stale = true },
+		"display name": func(snap *snapshot) { snap.Servers[0].DisplayName = "Argonnessen (64-bit)" },
+		"tags":         func(snap *snapshot) { snap.Servers[0].Tags = []string{"64-bit"} },
+		"links": func(snap *snapshot) {
+			snap.Servers[0].Links = []types.WorldLink{{Title: "Wiki", URL: "https://ddowiki.com"}}
+		},
+	}
+	for name, change := range changes {
+		if hash(apiV2, formatJSON, change) == base {
+			t.Errorf("contentHash() did not change with the v2 %s", name)
+		}
+	}
+
+	if hash(apiV1, formatJSON, unchanged) == hash(apiV1, formatCSV, unchanged) {
+		t.Error("contentHash() is the same for different formats")
+	}
+	if hash(apiV1, formatCSV, func(snap *snapshot) { snap.Servers[1].State = types.StateError }) == hash(apiV1, formatCSV, unchanged) {
+		t.Error("contentHash() did not change with a state shown in CSV")
+	}
+
+	// snapshots are shared with the response, so hashing must not clear their timestamps
+	snap := goldenSnapshot()
+	if _, err := contentHash(apiV2, formatJSON, snap); err != nil || snap.GeneratedAt.IsZero() || snap.Servers[0].CheckedAt.IsZero() {
+		t.Errorf("contentHash() modified the snapshot: %v", err)
+	}
+}
+
+func TestNotModified(t *testing.T) {
+	etag := `W/"v1-abc"`
+	lastModified := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name    string
+		headers map[string]string
+		want    bool
+	}{
+		{name: "no conditional headers", headers: nil, want: false},
+		{name: "matching etag", headers: map[string]string{"If-None-Match": etag}, want: true},
+		{name: "strong form of weak etag", headers: map[string]string{"if-none-match": `"v1-abc"`}, want: true},
+		{name: "etag in list", headers: map[string]string{"If-None-Match": `"other", W/"v1-abc"`}, want: true},
+		{name: "wildcard", headers: map[string]string{"If-None-Match": "*"}, want: true},
+		{name: "different etag", headers: map[string]string{"If-None-Match": `W/"v2-abc"`}, want: false},
+		{
+			name:    "not modified since",
+			headers: map[string]string{"If-Modified-Since": lastModified.Format(http.TimeFormat)},
+			want:    true,
+		},
+		{
+			name:    "modified since",
+			headers: map[string]string{"If-Modified-Since": lastModified.Add(-time.Hour).Format(http.TimeFormat)},
+			want:    false,
+		},
+		{
+			name:    "invalid date",
+			headers: map[string]string{"If-Modified-Since": "yesterday"},
+			want:    false,
+		},
+		{
+			name: "etag takes precedence",
+			headers: map[string]string{
+				"If-None-Match":     `W/"stale"`,
+				"If-Modified-Since": lastModified.Format(http.TimeFormat),
+			},
+			want: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := events.APIGatewayProxyRequest{Headers: tt.headers}
+			if got := notModified(req, etag, lastModified); got != tt.want {
+				t.Errorf("notModified() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCacheControl(t *testing.T) {
+	tests := []struct {
+		name  string
+		cache CacheConfig
+		want  string
+	}{
+		{name: "defaults", cache: defaultConfig().Cache, want: "public, max-age=30, stale-while-revalidate=30"},
+		{
+			name:  "configured directives",
+			cache: CacheConfig{MaxAge: Duration{time.Minute}, StaleIfError: Duration{5 * time.Minute}},
+			want:  "public, max-age=60, stale-if-error=300",
+		},
+		{name: "override", cache: CacheConfig{MaxAge: Duration{time.Minute}, Control: "no-store"}, want: "no-store"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useConfig(t, func(c *Config) {
+				c.Cache = tt.cache
+			})
+
+			if got := cacheControl(); got != tt.want {
+				t.Errorf("cacheControl() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHandleRequestConditional(t *testing.T) {
+	statusServer := newXMLTestServer(statusResponse)
+	defer statusServer.Close()
+
+	datacenterServer := newXMLTestServer(fmt.Sprintf(dcResponse, statusServer.URL))
+	defer datacenterServer.Close()
+
+	cleanup := setupEnv(t, datacenterServer.URL)
+	defer cleanup()
+
+	first, err := handleRequest(context.Background(), events.APIGatewayProxyRequest{Path: "/server_status"})
+	if err != nil {
+		t.Fatalf("handleRequest() error = %v", err)
+	}
+
+	etag := first.Headers["ETag"]
+	if etag == "" || first.Headers["Last-Modified"] == "" || first.Headers["Cache-Control"] == "" {
+		t.Fatalf("caching headers missing: %v", first.Headers)
+	}
+
+	second, err := handleRequest(context.Background(), events.APIGatewayProxyRequest{
+		Path:    "/server_status",
+		Headers: map[string]string{"If-None-Match": etag},
+	})
+	if err != nil {
+		t.Fatalf("handleRequest() error = %v", err)
+	}
+
+	if second.StatusCode != http.StatusNotModified {
+		t.Errorf("status = %v, want %v", second.StatusCode, http.StatusNotModified)
+	}
+	if second.Body != "" {
+		t.Errorf("304 response has a body: %q", second.Body)
+	}
+	if second.Headers["ETag"] != etag {
+		t.Errorf("ETag = %q, want %q", second.Headers["ETag"], etag)
+	}
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/redis/go-redis/v9"
+	"github.com/veteran-software/yourddo-api/shared/types"
+	"strings"
+	"sync"
+	"time"
+)
+
+const defaultChangeLogSize = 200
+
+// ChangeEvent is a single state transition of a world between two polls.
+type ChangeEvent struct {
+	ID         string `json:"id"`
+	World      string `json:"world"`
+	CommonName string `json:"commonName"`
+	// DisplayName is the name the world was shown with when the event was recorded.
+	DisplayName string            `json:"displayName,omitempty"`
+	From        types.ServerState `json:"from"`
+	To          types.ServerState `json:"to"`
+	At          time.Time         `json:"at"`
+}
+
+// name is the name the event is shown with; events recorded before display names were kept fall back to World.
+func (e ChangeEvent) name() string {
+	if e.DisplayName != "" {
+		return e.DisplayName
+	}
+
+	return e.World
+}
+
+// ChangeStore records world state transitions. Record compares the polled servers with their previous states and
+// stores an event for each world that went online or offline; the first time a world is seen its state is only
+// remembered, as there is nothing to compare it against. Unknown and error states say nothing about the world itself,
+// only that it could not be polled, so they are neither recorded nor remembered. Events returns the most recent
+// events, newest first.
+type ChangeStore interface {
+	Record(ctx context.Context, servers []*types.ServerInfo, at time.Time) error
+	Events(ctx context.Context) ([]ChangeEvent, error)
+}
+
+// changeEvent returns the event recorded when server is first seen in its state, or false when the state is not
+// tracked. Only online and offline are tracked, so the previous state is always the other one.
+func changeEvent(server *types.ServerInfo, at time.Time) (ChangeEvent, bool) {
+	var from types.ServerState
+	switch server.State {
+	case types.StateOnline:
+		from = types.StateOffline
+	case types.StateOffline:
+		from = types.StateOnline
+	default:
+		return ChangeEvent{}, false
+	}
+
+	return ChangeEvent{
+		ID:          changeEventID(server.Name, server.State, at),
+		World:       server.Name,
+		CommonName:  server.CommonName,
+		DisplayName: displayName(server),
+		From:        from,
+		To:          server.State,
+		At:          at.UTC(),
+	}, true
+}
+
+// ChangeLog keeps transitions in the memory of one container, which suits a single long-running instance. Behind
+// Lambda each container sees its own transitions and a cold start forgets them.
+type ChangeLog struct {
+	mu     sync.RWMutex
+	max    int
+	states map[string]types.ServerState
+	events []ChangeEvent
+}
+
+func NewChangeLog(max int) *ChangeLog {
+	return &ChangeLog{
+		max:    max,
+		states: make(map[string]types.ServerState),
+	}
+}
+
+func (c *ChangeLog) Record(_ context.Context, servers []*types.ServerInfo, at time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, server := range servers {
+		event, ok := changeEvent(server, at)
+		if !ok {
+			continue
+		}
+
+		previous, seen := c.states[server.Name]
+		c.states[server.Name] = server.State
+
+		if seen && previous != server.State {
+			c.events = append(c.events, event)
+		}
+	}
+
+	if len(c.events) > c.max {
+		c.events = c.events[len(c.events)-c.max:]
+	}
+
+	return nil
+}
+
+func (c *ChangeLog) Events(context.Context) ([]ChangeEvent, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	events := make([]ChangeEvent, len(c.events))
+	for i, event := range c.events {
+		events[len(c.events)-1-i] = event
+	}
+
+	return events, nil
+}
+
+// recordChangesScript stores the state of each world given as a name, state and encoded event triple, and pushes the
+// event when the world had a different state before. Running it as one script makes the comparison atomic, so when
+// several containers poll the same transition only the first records it, with its ID.
+var recordChangesScript = redis.NewScript(`
+local max = tonumber(ARGV[1])
+for i = 2, #ARGV, 3 do
+	local previous = redis.call('HGET', KEYS[1], ARGV[i])
+	redis.call('HSET', KEYS[1], ARGV[i], ARGV[i + 1])
+	if previous and previous ~= ARGV[i + 1] then
+		redis.call('LPUSH', KEYS[2], ARGV[i + 2])
+	end
+end
+redis.call('LTRIM', KEYS[2], 0, max - 1)
+return 0
+`)
+
+const (
+	changeStatesKey = "changes:states"
+	changeEventsKey = "changes:events"
+)
+
+// RedisChangeStore keeps world states and transitions in Redis, so every container serves the same feed and it
+// survives cold starts.
+type RedisChangeStore struct {
+	client *redis.Client
+	max    int
+}
+
+func NewRedisChangeStore(client *redis.Client, max int) *RedisChangeStore {
+	return &RedisChangeStore{client: client, max: max}
+}
+
+func (s *RedisChangeStore) Record(ctx context.Context, servers []*types.ServerInfo, at time.Time) error {
+	args := []any{s.max}
+	for _, server := range servers {
+		event, ok := changeEvent(server, at)
+		if !ok {
+			continue
+		}
+
+		encoded, err := json.Marshal(event)
+		if err != nil {
+			return fmt.Errorf("error encoding change event: %w", err)
+		}
+
+		args = append(args, server.Name, string(server.State), string(encoded))
+	}
+
+	if len(args) == 1 {
+		return nil
+	}
+
+	if err := recordChangesScript.Run(ctx, s.client, []string{changeStatesKey, changeEventsKey}, args...).Err(); err != nil {
+		return fmt.Errorf("error recording changes: %w", err)
+	}
+
+	return nil
+}
+
+func (s *RedisChangeStore) Events(ctx context.Context) ([]ChangeEvent, error) {
+	encoded, err := s.client.LRange(ctx, changeEventsKey, 0, int64(s.max)-1).Result()
+	if err != nil {
+		return nil, fmt.Errorf("error reading changes: %w", err)
+	}
+
+	events := make([]ChangeEvent, 0, len(encoded))
+	for _, value := range encoded {
+		var event ChangeEvent
+		if err := json.Unmarshal([]byte(value), &event); err != nil {
+			return nil, fmt.Errorf("error decoding change event: %w", err)
+		}
+		events = append(events, event)
+	}
+
+	return events, nil
+}
+
+// changeStoreFromConfig keeps transitions in client, the shared Redis server, when set, and in memory otherwise.
+func changeStoreFromConfig(client *redis.Client) ChangeStore {
+	if client != nil {
+		return NewRedisChangeStore(client, defaultChangeLogSize)
+	}
+
+	return NewChangeLog(defaultChangeLogSize)
+}
+
+// changes is shared across invocations so the feeds can list transitions seen by earlier polls.
+var changes ChangeStore
+
+// changeEventID derives an ID from the world, its new state and the transition time, so the same transition always
+// gets the same ID and feed readers do not show it twice.
+func changeEventID(world string, state types.ServerState, at time.Time) string {
+	slug := strings.ToLower(strings.Join(strings.Fields(world), "-"))
+	return fmt.Sprintf("urn:yourddo:server-status:%s:%d:%s", slug, at.Unix(), state)
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"github.com/veteran-software/yourddo-api/shared/types"
+	"testing"
+	"time"
+)
+
+// testChangeStore polls two worlds through a series of states and checks the events recorded by store, which keeps
+// at most two.
+func testChangeStore(t *testing.T, store ChangeStore) {
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	poll := func(offset time.Duration, states ...types.ServerState) {
+		servers := []*types.ServerInfo{
+			{Name: "Argonnessen", DisplayName: "Argonnessen (64-bit)", State: states[0]},
+			{Name: "Cannith", State: states[1]},
+		}
+		if err := store.Record(context.Background(), servers, start.Add(offset)); err != nil {
+			t.Fatalf("Record() error = %v", err)
+		}
+	}
+
+	events := func() []ChangeEvent {
+		got, err := store.Events(context.Background())
+		if err != nil {
+			t.Fatalf("Events() error = %v", err)
+		}
+		return got
+	}
+
+	poll(0, types.StateOnline, types.StateOnline)
+	if got := events(); len(got) != 0 {
+		t.Fatalf("first poll recorded %v events, want 0", len(got))
+	}
+
+	poll(time.Minute, types.StateOnline, types.StateOnline)
+	if got := events(); len(got) != 0 {
+		t.Fatalf("unchanged poll recorded %v events, want 0", len(got))
+	}
+
+	poll(2*time.Minute, types.StateError, types.StateUnknown)
+	if got := events(); len(got) != 0 {
+		t.Fatalf("failed polls recorded %v events, want 0", len(got))
+	}
+
+	poll(3*time.Minute, types.StateOnline, types.StateOffline)
+	poll(4*time.Minute, types.StateOffline, types.StateError)
+	poll(5*time.Minute, types.StateOnline, types.StateOffline)
+
+	got := events()
+	if len(got) != 2 {
+		t.Fatalf("Events() returned %v events, want 2 (capped)", len(got))
+	}
+
+	want := []ChangeEvent{
+		{
+			ID:          changeEventID("Argonnessen", types.StateOnline, start.Add(5*time.Minute)),
+			World:       "Argonnessen",
+			DisplayName: "Argonnessen (64-bit)",
+			From:        types.StateOffline,
+			To:          types.StateOnline,
+			At:          start.Add(5 * time.Minute),
+		},
+		{
+			ID:          changeEventID("Argonnessen", types.StateOffline, start.Add(4*time.Minute)),
+			World:       "Argonnessen",
+			DisplayName: "Argonnessen (64-bit)",
+			From:        types.StateOnline,
+			To:          types.StateOffline,
+			At:          start.Add(4 * time.Minute),
+		},
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("event %d = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestChangeLog(t *testing.T) {
+	testChangeStore(t, NewChangeLog(2))
+}
+
+func TestRedisChangeStore(t *testing.T) {
+	_, client := newTestRedis(t)
+	testChangeStore(t, NewRedisChangeStore(client, 2))
+}
+
+func TestRedisChangeStoreSharedAcrossContainers(t *testing.T) {
+	_, client := newTestRedis(t)
+
+	// Two stores stand in for two Lambda containers sharing one Redis server, each with its own poll time
+	first := NewRedisChangeStore(client, defaultChangeLogSize)
+	second := NewRedisChangeStore(client, defaultChangeLogSize)
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	record := func(store ChangeStore, offset time.Duration, state types.ServerState) {
+		if err := store.Record(context.Background(), []*types.ServerInfo{{Name: "Thelanis", State: state}}, start.Add(offset)); err != nil {
+			t.Fatalf("Record() error = %v", err)
+		}
+	}
+
+	record(first, 0, types.StateOnline)
+	record(second, time.Minute, types.StateOffline)
+	record(first, 2*time.Minute, types.StateOffline)
+
+	for name, store := range map[string]ChangeStore{"first": first, "second": second} {
+		got, err := store.Events(context.Background())
+		if err != nil {
+			t.Fatalf("Events() error = %v", err)
+		}
+		if len(got) != 1 || got[0].ID != changeEventID("Thelanis", types.StateOffline, start.Add(time.Minute)) {
+			t.Errorf("%s container Events() = %+v, want the one transition seen by the second container", name, got)
+		}
+	}
+
+	// A new container starts from the stored states and events
+	restarted := NewRedisChangeStore(client, defaultChangeLogSize)
+	record(restarted, 3*time.Minute, types.StateOffline)
+	if got, _ := restarted.Events(context.Background()); len(got) != 1 {
+		t.Errorf("restarted container Events() = %+v, want the stored event only", got)
+	}
+}
+
+func TestChangeEventIDIsStable(t *testing.T) {
+	at := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	first := changeEventID("Thrane Test", types.StateOnline, at)
+	second := changeEventID("Thrane Test", types.StateOnline, at)
+	if first != second {
+		t.Errorf("changeEventID() not stable: %q != %q", first, second)
+	}
+
+	want := "urn:yourddo:server-status:thrane-test:1704110400:online"
+	if first != want {
+		t.Errorf("changeEventID() = %q, want %q", first, want)
+	}
+}
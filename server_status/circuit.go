@@ -0,0 +1,122 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	defaultCircuitFailureThreshold = 3
+	defaultCircuitCooldownSeconds  = 60
+)
+
+type circuitState int
+
+const (
+	circuitClosed circuitState = iota
+	circuitOpen
+	circuitHalfOpen
+)
+
+func (s circuitState) String() string {
+	switch s {
+	case circuitOpen:
+		return "open"
+	case circuitHalfOpen:
+		return "half-open"
+	default:
+		return "closed"
+	}
+}
+
+type circuit struct {
+	state    circuitState
+	failures int
+	// since is when the circuit opened or, once half-open, when the last probe was let through.
+	since time.Time
+}
+
+// CircuitBreaker tracks consecutive failures per upstream URL. After threshold failures in a row a circuit
+// opens and the URL is skipped; once cooldown has passed a single probe is let through, which closes the circuit
+// on success or reopens it on failure.
+type CircuitBreaker struct {
+	mu        sync.Mutex
+	threshold int
+	cooldown  time.Duration
+	now       func() time.Time
+	circuits  map[string]*circuit
+}
+
+func NewCircuitBreaker(threshold int, cooldown time.Duration) *CircuitBreaker {
+	return &CircuitBreaker{
+		threshold: threshold,
+		cooldown:  cooldown,
+		now:       time.Now,
+		circuits:  make(map[string]*circuit),
+	}
+}
+
+// breaker holds circuit state for the lifetime of a warm container.
+var breaker *CircuitBreaker
+
+// Allow reports whether url should be fetched. A probe that never reports back does not hold the circuit half-open
+// forever: another one is let through after the next cooldown.
+func (b *CircuitBreaker) Allow(url string) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	c, ok := b.circuits[url]
+	if !ok || c.state == circuitClosed {
+		return true
+	}
+
+	now := b.now()
+	if now.Sub(c.since) < b.cooldown {
+		return false
+	}
+
+	c.state = circuitHalfOpen
+	c.since = now
+
+	return true
+}
+
+// RecordSuccess closes the circuit of url.
+func (b *CircuitBreaker) RecordSuccess(url string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	delete(b.circuits, url)
+}
+
+// RecordFailure counts a failure for url and returns the resulting state.
+func (b *CircuitBreaker) RecordFailure(url string) circuitState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	c, ok := b.circuits[url]
+	if !ok {
+		c = &circuit{}
+		b.circuits[url] = c
+	}
+
+	c.failures++
+	if c.state == circuitHalfOpen || c.failures >= b.threshold {
+		c.state = circuitOpen
+		c.since = b.now()
+	}
+
+	return c.state
+}
+
+// State returns the current state of the circuit of url.
+func (b *CircuitBreaker) State(url string) circuitState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if c, ok := b.circuits[url]; ok {
+		return c.state
+	}
+
+	return circuitClosed
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/veteran-software/yourddo-api/shared/types"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	const url = "http://world.example"
+
+	type step struct {
+		advance   time.Duration
+		allow     bool
+		outcome   string // "success", "failure" or "" when the fetch is skipped
+		wantState circuitState
+	}
+
+	tests := []struct {
+		name  string
+		steps []step
+	}{
+		{
+			name: "opens after threshold failures",
+			steps: []step{
+				{allow: true, outcome: "failure", wantState: circuitClosed},
+				{allow: true, outcome: "failure", wantState: circuitClosed},
+				{allow: true, outcome: "failure", wantState: circuitOpen},
+				{advance: 30 * time.Second, allow: false, wantState: circuitOpen},
+			},
+		},
+		{
+			name: "success resets the failure count",
+			steps: []step{
+				{allow: true, outcome: "failure", wantState: circuitClosed},
+				{allow: true, outcome: "failure", wantState: circuitClosed},
+				{allow: true, outcome: "success", wantState: circuitClosed},
+				{allow: true, outcome: "failure", wantState: circuitClosed},
+			},
+		},
+		{
+			name: "successful probe closes the circuit",
+			steps: []step{
+				{allow: true, outcome: "failure"},
+				{allow: true, outcome: "failure"},
+				{allow: true, outcome: "failure", wantState: circuitOpen},
+				{advance: time.Minute, allow: true, outcome: "success", wantState: circuitClosed},
+				{allow: true, wantState: circuitClosed},
+			},
+		},
+		{
+			name: "failed probe reopens the circuit",
+			steps: []step{
+				{allow: true, outcome: "failure"},
+				{allow: true, outcome: "failure"},
+				{allow: true, outcome: "failure", wantState: circuitOpen},
+				{advance: time.Minute, allow: true, outcome: "failure", wantState: circuitOpen},
+				{advance: 30 * time.Second, allow: false, wantState: circuitOpen},
+			},
+		},
+		{
+			name: "only one probe per cooldown",
+			steps: []step{
+				{allow: true, outcome: "failure"},
+				{allow: true, outcome: "failure"},
+				{allow: true, outcome: "failure", wantState: circuitOpen},
+				{advance: time.Minute, allow: true, wantState: circuitHalfOpen},
+				{allow: false, wantState: circuitHalfOpen},
+				{advance: time.Minute, allow: true, wantState: circuitHalfOpen},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			now := time.Unix(1704110400, 0)
+			b := NewCircuitBreaker(3, time.Minute)
+			b.now = func() time.Time { return now }
+
+			for i, s := range tt.steps {
+				now = now.Add(s.advance)
+
+				if got := b.Allow(url); got != s.allow {
+					t.Fatalf("step %d: Allow() = %v, want %v", i, got, s.allow)
+				}
+
+				switch s.outcome {
+				case "success":
+					b.RecordSuccess(url)
+				case "failure":
+					b.RecordFailure(url)
+				}
+
+				if got := b.State(url); got != s.wantState {
+					t.Fatalf("step %d: State() = %v, want %v", i, got, s.wantState)
+				}
+			}
+		})
+	}
+}
+
+func TestFetchSnapshotSkipsOpenCircuits(t *testing.T) {
+	var hits atomic.Int32
+	deadWorld := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer deadWorld.Close()
+
+	datacenterServer := newXMLTestServer(fmt.Sprintf(dcResponse, deadWorld.URL))
+	defer datacenterServer.Close()
+
+	cleanup := setupEnv(t, datacenterServer.URL)
+	defer cleanup()
+
+	for i := 0; i < defaultCircuitFailureThreshold; i++ {
+		snap := fetchSnapshot(context.Background())
+		if got := snap.Servers[0].State; got != types.StateError {
+			t.Fatalf("poll %d: state = %v, want %v", i, got, types.StateError)
+		}
+	}
+
+	snap := fetchSnapshot(context.Background())
+	if got := snap.Servers[0].State; got != types.StateUnknown {
+		t.Errorf("state with open circuit = %v, want %v", got, types.StateUnknown)
+	}
+	if len(snap.Errors) != 0 {
+		t.Errorf("errors with open circuit = %v, want none", snap.Errors)
+	}
+	if got := hits.Load(); got != defaultCircuitFailureThreshold {
+		t.Errorf("upstream hits = %d, want %d", got, defaultCircuitFailureThreshold)
+	}
+}
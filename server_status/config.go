@@ -0,0 +1,482 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/redis/go-redis/v9"
+	"gopkg.in/yaml.v3"
+	"io"
+	"log/slog"
+	"net/netip"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Duration is a time.Duration written as a Go duration string, such as "10s" or "250ms", in configuration files.
+type Duration struct {
+	time.Duration
+}
+
+func (d *Duration) UnmarshalText(text []byte) error {
+	parsed, err := time.ParseDuration(string(text))
+	if err != nil {
+		return fmt.Errorf("%q is not a duration such as \"10s\" or \"250ms\"", text)
+	}
+
+	d.Duration = parsed
+	return nil
+}
+
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(d.String()), nil
+}
+
+// Config holds every setting of the API. It is loaded once at cold start from, in increasing order of precedence, the
+// defaults, the file named by CONFIG_FILE, the SSM parameter named by CONFIG_SSM_PARAMETER and the environment.
+type Config struct {
+	// Environment names the deployment profile; dev, development and local allow localhost CORS origins.
+	Environment string `yaml:"environment"`
+	LogLevel    string `yaml:"logLevel"`
+	ListenAddr  string `yaml:"listenAddr"`
+	// PublicBaseURL is the address clients reach the API at, such as https://api.yourddo.com, used for self links.
+	PublicBaseURL string `yaml:"publicBaseUrl"`
+
+	DatacenterURLs      []string `yaml:"datacenterUrls"`
+	DatacenterCachePath string   `yaml:"datacenterCachePath"`
+	WorkerConcurrency   int      `yaml:"workerConcurrency"`
+	// WorldOverridesPath names a JSON file of display names, tags, links, pinned order and hiding per world.
+	WorldOverridesPath string `yaml:"worldOverridesPath"`
+	// WorldOverrides is read from WorldOverridesPath by LoadConfig, keyed by lowercased world name.
+	WorldOverrides map[string]WorldOverride `yaml:"-"`
+
+	Upstream  UpstreamConfig  `yaml:"upstream"`
+	Circuit   CircuitConfig   `yaml:"circuit"`
+	Hedge     HedgeConfig     `yaml:"hedge"`
+	Cache     CacheConfig     `yaml:"cache"`
+	CORS      CORSConfig      `yaml:"cors"`
+	Auth      AuthConfig      `yaml:"auth"`
+	RateLimit RateLimitConfig `yaml:"rateLimit"`
+	Features  FeatureConfig   `yaml:"features"`
+
+	// RedisURL names the Redis server that every instance shares rate limit buckets, quota counters, world
+	// transitions and the last good datacenter document through.
+	RedisURL string `yaml:"redisUrl"`
+}
+
+type UpstreamConfig struct {
+	Timeout       Duration `yaml:"timeout"`
+	HeaderTimeout Duration `yaml:"headerTimeout"`
+	MaxBodyBytes  int64    `yaml:"maxBodyBytes"`
+	// MaxConnsPerHost caps the connections open to one upstream host; 0 derives it from WorkerConcurrency.
+	MaxConnsPerHost int `yaml:"maxConnsPerHost"`
+	// Retries is the number of times a failed world status fetch is retried, waiting RetryBackoff before the first
+	// retry and twice as long before each following one.
+	Retries      int      `yaml:"retries"`
+	RetryBackoff Duration `yaml:"retryBackoff"`
+	AllowedHosts []string `yaml:"allowedHosts"`
+	AllowPrivate bool     `yaml:"allowPrivate"`
+	MaxRedirects int      `yaml:"maxRedirects"`
+}
+
+type CircuitConfig struct {
+	FailureThreshold int      `yaml:"failureThreshold"`
+	Cooldown         Duration `yaml:"cooldown"`
+}
+
+// HedgeConfig turns hedging on when Percentile is set.
+type HedgeConfig struct {
+	Percentile float64  `yaml:"percentile"`
+	MinDelay   Duration `yaml:"minDelay"`
+}
+
+// CacheConfig sets the directives of the Cache-Control header. Control, when set, is used verbatim instead.
+type CacheConfig struct {
+	MaxAge               Duration `yaml:"maxAge"`
+	StaleWhileRevalidate Duration `yaml:"staleWhileRevalidate"`
+	StaleIfError         Duration `yaml:"staleIfError"`
+	Control              string   `yaml:"control"`
+}
+
+type CORSConfig struct {
+	AllowedOrigins []string `yaml:"allowedOrigins"`
+}
+
+type AuthConfig struct {
+	KeysPath string `yaml:"keysPath"`
+	Required bool   `yaml:"required"`
+	// Keys is read from KeysPath by LoadConfig.
+	Keys *MemoryKeyStore `yaml:"-"`
+}
+
+// RateLimitConfig turns rate limiting on when PerMinute is set.
+type RateLimitConfig struct {
+	PerMinute int `yaml:"perMinute"`
+	Burst     int `yaml:"burst"`
+}
+
+type FeatureConfig struct {
+	// EMF writes CloudWatch Embedded Metric Format lines to stdout; it defaults to on inside Lambda.
+	EMF bool `yaml:"emf"`
+	// TracesExporter selects the OpenTelemetry exporter: otlp, console, or empty for no tracing.
+	TracesExporter string `yaml:"tracesExporter"`
+	ServiceName    string `yaml:"serviceName"`
+}
+
+// defaultConfig returns the configuration used for everything that is not set.
+func defaultConfig() *Config {
+	return &Config{
+		LogLevel:          "info",
+		WorkerConcurrency: defaultWorkerConcurrency,
+		Upstream: UpstreamConfig{
+			Timeout:       Duration{defaultUpstreamTimeoutSeconds * time.Second},
+			HeaderTimeout: Duration{defaultUpstreamHeaderTimeoutSeconds * time.Second},
+			MaxBodyBytes:  defaultUpstreamMaxBodyBytes,
+			RetryBackoff:  Duration{defaultRetryBackoff},
+			MaxRedirects:  defaultMaxRedirects,
+			AllowedHosts:  strings.Split(defaultUpstreamAllowedHosts, ","),
+		},
+		Circuit: CircuitConfig{
+			FailureThreshold: defaultCircuitFailureThreshold,
+			Cooldown:         Duration{defaultCircuitCooldownSeconds * time.Second},
+		},
+		Hedge: HedgeConfig{MinDelay: Duration{defaultHedgeMinDelay}},
+		Cache: CacheConfig{
+			MaxAge:               Duration{defaultCacheMaxAge * time.Second},
+			StaleWhileRevalidate: Duration{defaultCacheStaleWhileRevalidate * time.Second},
+		},
+		CORS:      CORSConfig{AllowedOrigins: strings.Split(defaultCORSAllowedOrigins, ",")},
+		RateLimit: RateLimitConfig{Burst: defaultRateLimitBurst},
+		Features:  FeatureConfig{ServiceName: defaultServiceName},
+	}
+}
+
+// LoadConfig builds the configuration and validates it. On a validation error the configuration is returned as well,
+// with every invalid setting listed in the error.
+func LoadConfig(ctx context.Context, lookup func(string) (string, bool)) (*Config, error) {
+	c := defaultConfig()
+
+	_, inLambda := lookup("AWS_LAMBDA_FUNCTION_NAME")
+	c.Features.EMF = inLambda
+
+	if path, _ := lookup("CONFIG_FILE"); path != "" {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return c, fmt.Errorf("error reading CONFIG_FILE: %w", err)
+		}
+
+		if err := c.decode(content); err != nil {
+			return c, fmt.Errorf("error decoding CONFIG_FILE %s: %w", path, err)
+		}
+	}
+
+	if name, _ := lookup("CONFIG_SSM_PARAMETER"); name != "" {
+		value, err := parameterSourceFromEnv(lookup).Parameter(ctx, name)
+		if err != nil {
+			return c, fmt.Errorf("error reading CONFIG_SSM_PARAMETER: %w", err)
+		}
+
+		if err := c.decode([]byte(value)); err != nil {
+			return c, fmt.Errorf("error decoding SSM parameter %s: %w", name, err)
+		}
+	}
+
+	errs := c.applyEnv(lookup)
+
+	worlds, err := loadWorldOverrides(c.WorldOverridesPath)
+	if err != nil {
+		errs = append(errs, err)
+	}
+	c.WorldOverrides = worlds
+
+	keys, err := loadAPIKeys(c.Auth.KeysPath)
+	if err != nil {
+		errs = append(errs, err)
+	}
+	c.Auth.Keys = keys
+
+	errs = append(errs, c.Validate()...)
+
+	return c, errors.Join(errs...)
+}
+
+// configErrors splits an error returned by LoadConfig into one error per invalid setting.
+func configErrors(err error) []error {
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		return joined.Unwrap()
+	}
+
+	return []error{err}
+}
+
+// decode merges a YAML or JSON document into c. Unknown keys are rejected, so a misspelt setting is not ignored.
+func (c *Config) decode(content []byte) error {
+	decoder := yaml.NewDecoder(bytes.NewReader(content))
+	decoder.KnownFields(true)
+
+	if err := decoder.Decode(c); err != nil && !errors.Is(err, io.EOF) {
+		return err
+	}
+
+	return nil
+}
+
+// applyEnv overrides c with the environment variables that are set, returning an error for each unparsable value.
+func (c *Config) applyEnv(lookup func(string) (string, bool)) []error {
+	var errs []error
+	env := func(name string, apply func(value string) error) {
+		value, ok := lookup(name)
+		if !ok || strings.TrimSpace(value) == "" {
+			return
+		}
+
+		if err := apply(strings.TrimSpace(value)); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", name, err))
+		}
+	}
+
+	env("APP_ENV", setString(&c.Environment))
+	env("LOG_LEVEL", setString(&c.LogLevel))
+	env("LISTEN_ADDR", setString(&c.ListenAddr))
+	env("PUBLIC_BASE_URL", setString(&c.PublicBaseURL))
+	env("DATACENTER_URL", setList(&c.DatacenterURLs))
+	env("DATACENTER_CACHE_PATH", setString(&c.DatacenterCachePath))
+	env("WORKER_CONCURRENCY", setInt(&c.WorkerConcurrency))
+	env("WORLD_OVERRIDES_PATH", setString(&c.WorldOverridesPath))
+
+	env("UPSTREAM_TIMEOUT_SECONDS", setDuration(&c.Upstream.Timeout, time.Second))
+	env("UPSTREAM_HEADER_TIMEOUT_SECONDS", setDuration(&c.Upstream.HeaderTimeout, time.Second))
+	env("UPSTREAM_MAX_BODY_BYTES", func(value string) error {
+		parsed, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return fmt.Errorf("%q is not a whole number", value)
+		}
+		c.Upstream.MaxBodyBytes = parsed
+		return nil
+	})
+	env("UPSTREAM_MAX_CONNS_PER_HOST", setInt(&c.Upstream.MaxConnsPerHost))
+	env("UPSTREAM_RETRIES", setInt(&c.Upstream.Retries))
+	env("UPSTREAM_RETRY_BACKOFF_MS", setDuration(&c.Upstream.RetryBackoff, time.Millisecond))
+	env("UPSTREAM_ALLOWED_HOSTS", setList(&c.Upstream.AllowedHosts))
+	env("UPSTREAM_ALLOW_PRIVATE", setBool(&c.Upstream.AllowPrivate))
+	env("UPSTREAM_MAX_REDIRECTS", setInt(&c.Upstream.MaxRedirects))
+
+	env("CIRCUIT_FAILURE_THRESHOLD", setInt(&c.Circuit.FailureThreshold))
+	env("CIRCUIT_COOLDOWN_SECONDS", setDuration(&c.Circuit.Cooldown, time.Second))
+
+	env("HEDGE_PERCENTILE", func(value string) error {
+		parsed, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return fmt.Errorf("%q is not a number", value)
+		}
+		c.Hedge.Percentile = parsed
+		return nil
+	})
+	env("HEDGE_MIN_DELAY_MS", setDuration(&c.Hedge.MinDelay, time.Millisecond))
+
+	env("CACHE_MAX_AGE", setDuration(&c.Cache.MaxAge, time.Second))
+	env("CACHE_STALE_WHILE_REVALIDATE", setDuration(&c.Cache.StaleWhileRevalidate, time.Second))
+	env("CACHE_STALE_IF_ERROR", setDuration(&c.Cache.StaleIfError, time.Second))
+	env("CACHE_CONTROL", setString(&c.Cache.Control))
+
+	env("CORS_ALLOWED_ORIGINS", setList(&c.CORS.AllowedOrigins))
+
+	env("API_KEYS_PATH", setString(&c.Auth.KeysPath))
+	env("API_KEY_REQUIRED", setBool(&c.Auth.Required))
+
+	env("RATE_LIMIT_PER_MINUTE", setInt(&c.RateLimit.PerMinute))
+	env("RATE_LIMIT_BURST", setInt(&c.RateLimit.Burst))
+
+	env("REDIS_URL", setString(&c.RedisURL))
+
+	env("EMF_ENABLED", setBool(&c.Features.EMF))
+	env("OTEL_TRACES_EXPORTER", setString(&c.Features.TracesExporter))
+	env("OTEL_SERVICE_NAME", setString(&c.Features.ServiceName))
+
+	return errs
+}
+
+func setString(target *string) func(string) error {
+	return func(value string) error {
+		*target = value
+		return nil
+	}
+}
+
+func setInt(target *int) func(string) error {
+	return func(value string) error {
+		parsed, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("%q is not a whole number", value)
+		}
+		*target = parsed
+		return nil
+	}
+}
+
+func setBool(target *bool) func(string) error {
+	return func(value string) error {
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("%q is not true or false", value)
+		}
+		*target = parsed
+		return nil
+	}
+}
+
+// setDuration parses a whole number of units, matching the _SECONDS and _MS suffixes of the variable names.
+func setDuration(target *Duration, unit time.Duration) func(string) error {
+	return func(value string) error {
+		parsed, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("%q is not a whole number", value)
+		}
+		target.Duration = time.Duration(parsed) * unit
+		return nil
+	}
+}
+
+// setList splits a comma-separated value, dropping blank entries.
+func setList(target *[]string) func(string) error {
+	return func(value string) error {
+		var list []string
+		for _, entry := range strings.Split(value, ",") {
+			if entry = strings.TrimSpace(entry); entry != "" {
+				list = append(list, entry)
+			}
+		}
+		*target = list
+		return nil
+	}
+}
+
+// Validate returns an error for every invalid setting, naming its configuration key and environment variable.
+func (c *Config) Validate() []error {
+	var errs []error
+	check := func(ok bool, format string, args ...any) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+
+	var level slog.Level
+	check(level.UnmarshalText([]byte(c.LogLevel)) == nil, "logLevel (LOG_LEVEL) %q must be debug, info, warn or error", c.LogLevel)
+
+	if len(c.DatacenterURLs) == 0 {
+		errs = append(errs, errDatacenterURLNotSet)
+	}
+	for _, raw := range c.DatacenterURLs {
+		parsed, err := url.ParseRequestURI(raw)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("DATACENTER_URL entry %q is not a valid URL: %w", raw, err))
+			continue
+		}
+
+		check(parsed.Scheme == "http" || parsed.Scheme == "https", "DATACENTER_URL entry %q must use http or https", raw)
+	}
+
+	if c.PublicBaseURL != "" {
+		parsed, err := url.Parse(c.PublicBaseURL)
+		check(err == nil && (parsed.Scheme == "http" || parsed.Scheme == "https") && parsed.Host != "" && parsed.RawQuery == "" && parsed.Fragment == "",
+			"publicBaseUrl (PUBLIC_BASE_URL) %q must be an http or https URL without a query", c.PublicBaseURL)
+	}
+
+	check(c.WorkerConcurrency >= 1, "workerConcurrency (WORKER_CONCURRENCY) must be at least 1, got %d", c.WorkerConcurrency)
+
+	u := c.Upstream
+	check(u.Timeout.Duration > 0, "upstream.timeout (UPSTREAM_TIMEOUT_SECONDS) must be positive")
+	check(u.HeaderTimeout.Duration > 0 && u.HeaderTimeout.Duration <= u.Timeout.Duration,
+		"upstream.headerTimeout (UPSTREAM_HEADER_TIMEOUT_SECONDS) must be positive and at most upstream.timeout, got %s", u.HeaderTimeout)
+	check(u.MaxBodyBytes >= 1, "upstream.maxBodyBytes (UPSTREAM_MAX_BODY_BYTES) must be at least 1, got %d", u.MaxBodyBytes)
+	check(u.MaxConnsPerHost == 0 || u.MaxConnsPerHost >= c.WorkerConcurrency,
+		"upstream.maxConnsPerHost (UPSTREAM_MAX_CONNS_PER_HOST) must be 0 or at least workerConcurrency (%d), got %d", c.WorkerConcurrency, u.MaxConnsPerHost)
+	check(u.Retries >= 0 && u.Retries <= maxUpstreamRetries, "upstream.retries (UPSTREAM_RETRIES) must be between 0 and %d, got %d", maxUpstreamRetries, u.Retries)
+	check(u.RetryBackoff.Duration >= 0, "upstream.retryBackoff (UPSTREAM_RETRY_BACKOFF_MS) must not be negative")
+	check(u.MaxRedirects >= 0, "upstream.maxRedirects (UPSTREAM_MAX_REDIRECTS) must not be negative, got %d", u.MaxRedirects)
+	check(len(u.AllowedHosts) > 0, "upstream.allowedHosts (UPSTREAM_ALLOWED_HOSTS) must not be empty; use %q to allow any public host", anyPublicHost)
+	for _, host := range u.AllowedHosts {
+		if _, err := netip.ParsePrefix(host); err == nil || host == anyPublicHost {
+			continue
+		}
+		pattern := strings.TrimPrefix(host, "*.")
+		check(pattern != "" && !strings.ContainsAny(pattern, "*/:@"), "upstream.allowedHosts (UPSTREAM_ALLOWED_HOSTS) entry %q must be a host name, *.suffix, address prefix or *", host)
+	}
+
+	check(c.Circuit.FailureThreshold >= 1, "circuit.failureThreshold (CIRCUIT_FAILURE_THRESHOLD) must be at least 1, got %d", c.Circuit.FailureThreshold)
+	check(c.Circuit.Cooldown.Duration > 0, "circuit.cooldown (CIRCUIT_COOLDOWN_SECONDS) must be positive")
+
+	check(c.Hedge.Percentile >= 0 && c.Hedge.Percentile < 100, "hedge.percentile (HEDGE_PERCENTILE) must be between 0 (off) and 100, got %g", c.Hedge.Percentile)
+	check(c.Hedge.MinDelay.Duration >= 0, "hedge.minDelay (HEDGE_MIN_DELAY_MS) must not be negative")
+
+	check(c.Cache.MaxAge.Duration >= 0, "cache.maxAge (CACHE_MAX_AGE) must not be negative")
+	check(c.Cache.StaleWhileRevalidate.Duration >= 0, "cache.staleWhileRevalidate (CACHE_STALE_WHILE_REVALIDATE) must not be negative")
+	check(c.Cache.StaleIfError.Duration >= 0, "cache.staleIfError (CACHE_STALE_IF_ERROR) must not be negative")
+
+	for _, origin := range c.CORS.AllowedOrigins {
+		errs = append(errs, validateOrigin("cors.allowedOrigins (CORS_ALLOWED_ORIGINS)", origin)...)
+	}
+
+	check(!c.Auth.Required || c.Auth.KeysPath != "", "auth.required (API_KEY_REQUIRED) needs auth.keysPath (API_KEYS_PATH)")
+
+	check(c.RateLimit.PerMinute >= 0, "rateLimit.perMinute (RATE_LIMIT_PER_MINUTE) must not be negative, got %d", c.RateLimit.PerMinute)
+	check(c.RateLimit.Burst >= 1, "rateLimit.burst (RATE_LIMIT_BURST) must be at least 1, got %d", c.RateLimit.Burst)
+
+	if c.RedisURL != "" {
+		if _, err := redis.ParseURL(c.RedisURL); err != nil {
+			errs = append(errs, fmt.Errorf("redisUrl (REDIS_URL): %w", err))
+		}
+	}
+
+	switch strings.ToLower(c.Features.TracesExporter) {
+	case "", "none", "otlp", "console", "stdout":
+	default:
+		errs = append(errs, fmt.Errorf("features.tracesExporter (OTEL_TRACES_EXPORTER) %q must be otlp, console or none", c.Features.TracesExporter))
+	}
+
+	return errs
+}
+
+// validateOrigin checks an origin or wildcard pattern such as "https://*.yourddo.com".
+func validateOrigin(setting, origin string) []error {
+	parsed, err := url.Parse(strings.Replace(origin, "*.", "wildcard.", 1))
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" ||
+		strings.Trim(parsed.Path, "/") != "" || parsed.RawQuery != "" || strings.Count(origin, "*") > 1 ||
+		(strings.Contains(origin, "*") && !strings.Contains(origin, "://*.")) {
+		return []error{fmt.Errorf("%s entry %q must be an origin such as https://example.com or https://*.example.com", setting, origin)}
+	}
+
+	return nil
+}
+
+// configLoadTimeout bounds loading the configuration at cold start, which may call the SSM parameter store.
+const configLoadTimeout = 10 * time.Second
+
+// cfg holds the defaults until main loads the configuration at cold start and passes it to applyConfig.
+var cfg *Config
+
+func init() {
+	applyConfig(defaultConfig())
+}
+
+// applyConfig makes c the configuration of the API and rebuilds everything derived from it.
+func applyConfig(c *Config) {
+	cfg = c
+
+	redisClient = redisClientFromConfig(c.RedisURL)
+	upstreamPolicy = upstreamPolicyFromConfig(c.Upstream)
+	upstreamLimits = upstreamLimitsFromConfig(c.Upstream)
+	upstreamClient = newUpstreamClient(upstreamLimits)
+	breaker = NewCircuitBreaker(c.Circuit.FailureThreshold, c.Circuit.Cooldown.Duration)
+	datacenters = &DatacenterSource{store: datacenterStoreFromConfig(c.DatacenterCachePath, redisClient)}
+	hedger = newHedgerFromConfig(c.Hedge)
+	emf = NewEMFLogger(os.Stdout, c.Features.EMF)
+	cors = corsPolicyFromConfig(c)
+	auth = authenticatorFromConfig(c.Auth, redisClient)
+	limiter = rateLimiterFromConfig(c.RateLimit, redisClient)
+	changes = changeStoreFromConfig(redisClient)
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+)
+
+const (
+	defaultParametersExtensionPort = "2773"
+	parameterTimeout               = 5 * time.Second
+)
+
+// ParameterSource reads parameters from SSM Parameter Store.
+type ParameterSource interface {
+	Parameter(ctx context.Context, name string) (string, error)
+}
+
+// parameterSourceFromEnv returns the local stand-in at CONFIG_SSM_LOCAL_PATH when it is set, and otherwise the
+// AWS Parameters and Secrets Lambda Extension.
+func parameterSourceFromEnv(lookup func(string) (string, bool)) ParameterSource {
+	if path, _ := lookup("CONFIG_SSM_LOCAL_PATH"); path != "" {
+		return FileParameterSource{path: path}
+	}
+
+	port, _ := lookup("PARAMETERS_SECRETS_EXTENSION_HTTP_PORT")
+	if port == "" {
+		port = defaultParametersExtensionPort
+	}
+	token, _ := lookup("AWS_SESSION_TOKEN")
+
+	return &ExtensionParameterSource{
+		endpoint: "http://localhost:" + port,
+		token:    token,
+		client:   &http.Client{Timeout: parameterTimeout},
+	}
+}
+
+// ExtensionParameterSource reads parameters through the AWS Parameters and Secrets Lambda Extension, which serves
+// Parameter Store over HTTP on localhost and caches the values, so no AWS SDK is needed.
+type ExtensionParameterSource struct {
+	endpoint string
+	token    string
+	client   *http.Client
+}
+
+func (s *ExtensionParameterSource) Parameter(ctx context.Context, name string) (value string, err error) {
+	query := url.Values{"name": {name}, "withDecryption": {"true"}}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.endpoint+"/systemsmanager/parameters/get?"+query.Encode(), nil)
+	if err != nil {
+		return "", fmt.Errorf("error creating parameter request: %w", err)
+	}
+	req.Header.Set("X-Aws-Parameters-Secrets-Token", s.token)
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("error fetching parameter %s: %w", name, err)
+	}
+	defer closeBody(ctx, resp.Body, req.URL.Path, &err)
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("error fetching parameter %s: unexpected status code: %d", name, resp.StatusCode)
+	}
+
+	var body struct {
+		Parameter struct {
+			Value string `json:"Value"`
+		} `json:"Parameter"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return "", fmt.Errorf("error decoding parameter %s: %w", name, err)
+	}
+
+	return body.Parameter.Value, nil
+}
+
+// FileParameterSource is a local stand-in for Parameter Store: a JSON object mapping parameter names to values.
+type FileParameterSource struct {
+	path string
+}
+
+func (s FileParameterSource) Parameter(_ context.Context, name string) (string, error) {
+	content, err := os.ReadFile(s.path)
+	if err != nil {
+		return "", fmt.Errorf("error reading local parameters: %w", err)
+	}
+
+	var parameters map[string]string
+	if err := json.Unmarshal(content, &parameters); err != nil {
+		return "", fmt.Errorf("error decoding local parameters %s: %w", s.path, err)
+	}
+
+	value, ok := parameters[name]
+	if !ok {
+		return "", fmt.Errorf("parameter %s not found in %s", name, s.path)
+	}
+
+	return value, nil
+}
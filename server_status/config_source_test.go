@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestParameterSourceFromEnv(t *testing.T) {
+	local := parameterSourceFromEnv(lookupMap(map[string]string{"CONFIG_SSM_LOCAL_PATH": "parameters.json"}))
+	if got, ok := local.(FileParameterSource); !ok || got.path != "parameters.json" {
+		t.Errorf("parameterSourceFromEnv() = %#v, want the local stand-in", local)
+	}
+
+	extension := parameterSourceFromEnv(lookupMap(map[string]string{
+		"PARAMETERS_SECRETS_EXTENSION_HTTP_PORT": "2800",
+		"AWS_SESSION_TOKEN":                      "session",
+	}))
+	if got, ok := extension.(*ExtensionParameterSource); !ok || got.endpoint != "http://localhost:2800" || got.token != "session" {
+		t.Errorf("parameterSourceFromEnv() = %#v, want the extension on port 2800", extension)
+	}
+}
+
+func TestExtensionParameterSource(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Aws-Parameters-Secrets-Token") != "session" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		if r.URL.Path != "/systemsmanager/parameters/get" || r.URL.Query().Get("withDecryption") != "true" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		switch r.URL.Query().Get("name") {
+		case "/yourddo/server-status":
+			_, _ = w.Write([]byte(`{"Parameter": {"Name": "/yourddo/server-status", "Value": "logLevel: debug"}}`))
+		case "/yourddo/broken":
+			_, _ = w.Write([]byte(`{"Parameter":`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name    string
+		token   string
+		want    string
+		wantErr bool
+	}{
+		{name: "/yourddo/server-status", token: "session", want: "logLevel: debug"},
+		{name: "/yourddo/missing", token: "session", wantErr: true},
+		{name: "/yourddo/broken", token: "session", wantErr: true},
+		{name: "/yourddo/server-status", token: "stale", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			source := &ExtensionParameterSource{endpoint: server.URL, token: tt.token, client: server.Client()}
+
+			got, err := source.Parameter(context.Background(), tt.name)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Parameter() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("Parameter() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFileParameterSource(t *testing.T) {
+	path := writeConfigFile(t, "parameters.json", `{"/yourddo/server-status": "logLevel: warn"}`)
+
+	got, err := FileParameterSource{path: path}.Parameter(context.Background(), "/yourddo/server-status")
+	if err != nil || got != "logLevel: warn" {
+		t.Errorf("Parameter() = %q, %v, want logLevel: warn", got, err)
+	}
+
+	if _, err := (FileParameterSource{path: path}).Parameter(context.Background(), "/yourddo/missing"); err == nil {
+		t.Error("Parameter() found a missing parameter")
+	}
+	if _, err := (FileParameterSource{path: path + ".missing"}).Parameter(context.Background(), "/yourddo/server-status"); err == nil {
+		t.Error("Parameter() read a missing file")
+	}
+}
@@ -0,0 +1,322 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// useConfig replaces cfg with a copy changed by configure for the rest of the test.
+func useConfig(t *testing.T, configure func(c *Config)) {
+	previous := cfg
+	next := *cfg
+	configure(&next)
+	cfg = &next
+	t.Cleanup(func() {
+		cfg = previous
+	})
+}
+
+// lookupMap returns a lookup function reading env instead of the process environment.
+func lookupMap(env map[string]string) func(string) (string, bool) {
+	return func(key string) (string, bool) {
+		value, ok := env[key]
+		return value, ok
+	}
+}
+
+// writeConfigFile writes content to a file in a temporary directory and returns its path.
+func writeConfigFile(t *testing.T, name, content string) string {
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+func TestDuration(t *testing.T) {
+	var d Duration
+	if err := d.UnmarshalText([]byte("1m30s")); err != nil || d.Duration != 90*time.Second {
+		t.Errorf("UnmarshalText() = %v, %v, want 1m30s", d, err)
+	}
+	if err := d.UnmarshalText([]byte("30")); err == nil {
+		t.Error("UnmarshalText() accepted a duration without a unit")
+	}
+
+	text, err := Duration{250 * time.Millisecond}.MarshalText()
+	if err != nil || string(text) != "250ms" {
+		t.Errorf("MarshalText() = %q, %v, want 250ms", text, err)
+	}
+}
+
+func TestLoadConfigDefaults(t *testing.T) {
+	got, err := LoadConfig(context.Background(), lookupMap(map[string]string{"DATACENTER_URL": "https://gls.ddo.com/dc"}))
+	if err != nil {
+		t.Fatalf("LoadConfig() error = %v", err)
+	}
+
+	want := defaultConfig()
+	want.DatacenterURLs = []string{"https://gls.ddo.com/dc"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("LoadConfig() = %+v, want %+v", got, want)
+	}
+}
+
+func TestLoadConfigEnv(t *testing.T) {
+	overridesPath := writeConfigFile(t, "overrides.json", `{}`)
+	env := map[string]string{
+		"AWS_LAMBDA_FUNCTION_NAME":  "server-status",
+		"DATACENTER_URL":            "https://a.example/dc, https://b.example/dc,",
+		"LOG_LEVEL":                 "debug",
+		"WORKER_CONCURRENCY":        " 4 ",
+		"WORLD_OVERRIDES_PATH":      overridesPath,
+		"UPSTREAM_TIMEOUT_SECONDS":  "20",
+		"UPSTREAM_RETRIES":          "2",
+		"UPSTREAM_RETRY_BACKOFF_MS": "50",
+		"UPSTREAM_ALLOW_PRIVATE":    "true",
+		"HEDGE_PERCENTILE":          "95",
+		"CACHE_STALE_IF_ERROR":      "300",
+		"RATE_LIMIT_PER_MINUTE":     "120",
+		"OTEL_SERVICE_NAME":         "",
+	}
+
+	got, err := LoadConfig(context.Background(), lookupMap(env))
+	if err != nil {
+		t.Fatalf("LoadConfig() error = %v", err)
+	}
+
+	if !reflect.DeepEqual(got.DatacenterURLs, []string{"https://a.example/dc", "https://b.example/dc"}) {
+		t.Errorf("DatacenterURLs = %v", got.DatacenterURLs)
+	}
+	if got.LogLevel != "debug" || got.WorkerConcurrency != 4 || got.WorldOverridesPath != overridesPath {
+		t.Errorf("LogLevel = %q, WorkerConcurrency = %d, WorldOverridesPath = %q", got.LogLevel, got.WorkerConcurrency, got.WorldOverridesPath)
+	}
+	if got.Upstream.Timeout.Duration != 20*time.Second || got.Upstream.Retries != 2 ||
+		got.Upstream.RetryBackoff.Duration != 50*time.Millisecond || !got.Upstream.AllowPrivate {
+		t.Errorf("Upstream = %+v", got.Upstream)
+	}
+	if got.Hedge.Percentile != 95 || got.Cache.StaleIfError.Duration != 5*time.Minute || got.RateLimit.PerMinute != 120 {
+		t.Errorf("Hedge = %+v, Cache = %+v, RateLimit = %+v", got.Hedge, got.Cache, got.RateLimit)
+	}
+	if !got.Features.EMF {
+		t.Error("Features.EMF = false inside Lambda, want true")
+	}
+	if got.Features.ServiceName != defaultServiceName {
+		t.Errorf("Features.ServiceName = %q, want the default for a blank variable", got.Features.ServiceName)
+	}
+}
+
+func TestLoadConfigFile(t *testing.T) {
+	path := writeConfigFile(t, "config.yaml", `
+logLevel: warn
+datacenterUrls:
+  - https://file.example/dc
+upstream:
+  timeout: 15s
+  retries: 3
+cors:
+  allowedOrigins: [https://*.yourddo.com]
+`)
+
+	got, err := LoadConfig(context.Background(), lookupMap(map[string]string{
+		"CONFIG_FILE": path,
+		"LOG_LEVEL":   "error",
+	}))
+	if err != nil {
+		t.Fatalf("LoadConfig() error = %v", err)
+	}
+
+	if got.LogLevel != "error" {
+		t.Errorf("LogLevel = %q, want the environment to win over the file", got.LogLevel)
+	}
+	if !reflect.DeepEqual(got.DatacenterURLs, []string{"https://file.example/dc"}) {
+		t.Errorf("DatacenterURLs = %v", got.DatacenterURLs)
+	}
+	if got.Upstream.Timeout.Duration != 15*time.Second || got.Upstream.Retries != 3 {
+		t.Errorf("Upstream = %+v", got.Upstream)
+	}
+	if got.Upstream.HeaderTimeout.Duration != defaultUpstreamHeaderTimeoutSeconds*time.Second {
+		t.Errorf("Upstream.HeaderTimeout = %v, want the default for a setting missing from the file", got.Upstream.HeaderTimeout)
+	}
+	if !reflect.DeepEqual(got.CORS.AllowedOrigins, []string{"https://*.yourddo.com"}) {
+		t.Errorf("CORS.AllowedOrigins = %v", got.CORS.AllowedOrigins)
+	}
+}
+
+func TestLoadConfigSSMParameter(t *testing.T) {
+	file := writeConfigFile(t, "config.json", `{"datacenterUrls": ["https://file.example/dc"], "workerConcurrency": 2}`)
+	parameters := writeConfigFile(t, "parameters.json", `{"/yourddo/server-status": "workerConcurrency: 8\nrateLimit:\n  perMinute: 30\n"}`)
+
+	got, err := LoadConfig(context.Background(), lookupMap(map[string]string{
+		"CONFIG_FILE":           file,
+		"CONFIG_SSM_PARAMETER":  "/yourddo/server-status",
+		"CONFIG_SSM_LOCAL_PATH": parameters,
+	}))
+	if err != nil {
+		t.Fatalf("LoadConfig() error = %v", err)
+	}
+
+	if got.WorkerConcurrency != 8 || got.RateLimit.PerMinute != 30 {
+		t.Errorf("WorkerConcurrency = %d, RateLimit.PerMinute = %d, want the parameter to win over the file", got.WorkerConcurrency, got.RateLimit.PerMinute)
+	}
+	if !reflect.DeepEqual(got.DatacenterURLs, []string{"https://file.example/dc"}) {
+		t.Errorf("DatacenterURLs = %v, want the file's value", got.DatacenterURLs)
+	}
+}
+
+func TestLoadConfigErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		env     map[string]string
+		file    string
+		wantErr []string
+	}{
+		{
+			name:    "missing datacenter URL",
+			env:     map[string]string{},
+			wantErr: []string{errDatacenterURLNotSet.Error()},
+		},
+		{
+			name:    "unknown file key",
+			env:     map[string]string{"DATACENTER_URL": "https://gls.ddo.com/dc"},
+			file:    "upstream:\n  timeuot: 5s\n",
+			wantErr: []string{"field timeuot not found"},
+		},
+		{
+			name:    "bad file duration",
+			env:     map[string]string{"DATACENTER_URL": "https://gls.ddo.com/dc"},
+			file:    "circuit:\n  cooldown: 30\n",
+			wantErr: []string{`"30" is not a duration`},
+		},
+		{
+			name: "unparsable variables",
+			env: map[string]string{
+				"DATACENTER_URL":         "https://gls.ddo.com/dc",
+				"WORKER_CONCURRENCY":     "lots",
+				"UPSTREAM_ALLOW_PRIVATE": "sometimes",
+			},
+			wantErr: []string{
+				`WORKER_CONCURRENCY: "lots" is not a whole number`,
+				`UPSTREAM_ALLOW_PRIVATE: "sometimes" is not true or false`,
+			},
+		},
+		{
+			name: "invalid settings",
+			env: map[string]string{
+				"DATACENTER_URL":                  "ftp://gls.ddo.com/dc",
+				"PUBLIC_BASE_URL":                 "api.yourddo.com",
+				"LOG_LEVEL":                       "verbose",
+				"UPSTREAM_TIMEOUT_SECONDS":        "5",
+				"UPSTREAM_HEADER_TIMEOUT_SECONDS": "10",
+				"UPSTREAM_MAX_CONNS_PER_HOST":     "4",
+				"UPSTREAM_RETRIES":                "9",
+				"UPSTREAM_ALLOWED_HOSTS":          " , ",
+				"CIRCUIT_FAILURE_THRESHOLD":       "0",
+				"HEDGE_PERCENTILE":                "100",
+				"CORS_ALLOWED_ORIGINS":            "yourddo.com",
+				"API_KEY_REQUIRED":                "true",
+				"REDIS_URL":                       "http://cache.internal",
+				"OTEL_TRACES_EXPORTER":            "zipkin",
+			},
+			wantErr: []string{
+				`logLevel (LOG_LEVEL) "verbose"`,
+				`DATACENTER_URL entry "ftp://gls.ddo.com/dc" must use http or https`,
+				`publicBaseUrl (PUBLIC_BASE_URL) "api.yourddo.com"`,
+				"upstream.headerTimeout (UPSTREAM_HEADER_TIMEOUT_SECONDS)",
+				"upstream.maxConnsPerHost (UPSTREAM_MAX_CONNS_PER_HOST) must be 0 or at least workerConcurrency (16), got 4",
+				"upstream.retries (UPSTREAM_RETRIES) must be between 0 and 5, got 9",
+				"upstream.allowedHosts (UPSTREAM_ALLOWED_HOSTS) must not be empty",
+				"circuit.failureThreshold (CIRCUIT_FAILURE_THRESHOLD)",
+				"hedge.percentile (HEDGE_PERCENTILE)",
+				`cors.allowedOrigins (CORS_ALLOWED_ORIGINS) entry "yourddo.com"`,
+				"auth.required (API_KEY_REQUIRED) needs auth.keysPath (API_KEYS_PATH)",
+				"redisUrl (REDIS_URL)",
+				`features.tracesExporter (OTEL_TRACES_EXPORTER) "zipkin"`,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.file != "" {
+				tt.env["CONFIG_FILE"] = writeConfigFile(t, "config.yaml", tt.file)
+			}
+
+			_, err := LoadConfig(context.Background(), lookupMap(tt.env))
+			if err == nil {
+				t.Fatal("LoadConfig() error = nil")
+			}
+
+			errs := configErrors(err)
+			if len(errs) != len(tt.wantErr) {
+				t.Fatalf("LoadConfig() errors = %q, want %d", errs, len(tt.wantErr))
+			}
+			for i, want := range tt.wantErr {
+				if !strings.Contains(errs[i].Error(), want) {
+					t.Errorf("error %d = %q, want it to contain %q", i, errs[i], want)
+				}
+			}
+		})
+	}
+}
+
+func TestApplyConfig(t *testing.T) {
+	previous, previousPolicy := cfg, upstreamPolicy
+	t.Cleanup(func() {
+		applyConfig(previous)
+		upstreamPolicy = previousPolicy
+	})
+
+	next := defaultConfig()
+	next.Upstream.AllowedHosts = []string{"gls.ddo.com"}
+	next.Circuit.FailureThreshold = 7
+	next.RateLimit.PerMinute = 30
+	next.RedisURL = "redis://cache.internal:6379/1"
+
+	applyConfig(next)
+
+	if cfg != next {
+		t.Error("cfg was not replaced")
+	}
+	if !reflect.DeepEqual(upstreamPolicy.AllowedHosts, []string{"gls.ddo.com"}) {
+		t.Errorf("upstreamPolicy.AllowedHosts = %v", upstreamPolicy.AllowedHosts)
+	}
+	if breaker.threshold != 7 {
+		t.Errorf("breaker threshold = %d, want 7", breaker.threshold)
+	}
+	if redisClient == nil || limiter.limit.PerMinute != 30 {
+		t.Errorf("redisClient = %v, limiter limit = %+v", redisClient, limiter.limit)
+	}
+	if _, ok := changes.(*RedisChangeStore); !ok {
+		t.Errorf("changes = %T, want the Redis store", changes)
+	}
+}
+
+func TestValidateOrigin(t *testing.T) {
+	tests := []struct {
+		origin  string
+		wantErr bool
+	}{
+		{origin: "https://yourddo.com"},
+		{origin: "http://localhost:3000"},
+		{origin: "https://*.yourddo.com"},
+		{origin: "yourddo.com", wantErr: true},
+		{origin: "ftp://yourddo.com", wantErr: true},
+		{origin: "https://yourddo.com/path", wantErr: true},
+		{origin: "https://yourddo.*", wantErr: true},
+		{origin: "https://*.*.yourddo.com", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.origin, func(t *testing.T) {
+			if errs := validateOrigin("origins", tt.origin); (len(errs) > 0) != tt.wantErr {
+				t.Errorf("validateOrigin() = %v, wantErr %v", errs, tt.wantErr)
+			}
+		})
+	}
+}
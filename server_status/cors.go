@@ -0,0 +1,184 @@
+package main
+
+import (
+	"github.com/aws/aws-lambda-go/events"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+)
+
+const defaultCORSAllowedOrigins = "https://ddocompendium.com,https://yourddo.com,https://*.yourddo.com"
+
+// corsAllowedHeaders are the request headers a cross-origin caller may send.
+var corsAllowedHeaders = []string{"authorization", "content-type", "if-modified-since", "if-none-match", "x-api-key"}
+
+// CORSPolicy decides which browser origins may read responses. Origins are matched exactly or against patterns such
+// as "https://*.yourddo.com", which match any subdomain but not the bare domain.
+type CORSPolicy struct {
+	origins        []string
+	wildcards      [][2]string
+	allowLocalhost bool
+}
+
+// NewCORSPolicy builds a policy from a list of origins and wildcard patterns.
+func NewCORSPolicy(origins []string, allowLocalhost bool) *CORSPolicy {
+	policy := &CORSPolicy{allowLocalhost: allowLocalhost}
+
+	for _, origin := range origins {
+		origin = strings.ToLower(strings.TrimRight(strings.TrimSpace(origin), "/"))
+		if origin == "" {
+			continue
+		}
+
+		if prefix, suffix, ok := strings.Cut(origin, "*"); ok {
+			policy.wildcards = append(policy.wildcards, [2]string{prefix, suffix})
+			continue
+		}
+
+		policy.origins = append(policy.origins, origin)
+	}
+
+	return policy
+}
+
+// corsPolicyFromConfig builds the policy from the allowed origins. Localhost origins are allowed when the environment
+// names a development profile.
+func corsPolicyFromConfig(c *Config) *CORSPolicy {
+	return NewCORSPolicy(c.CORS.AllowedOrigins, isDevProfile(c.Environment))
+}
+
+// isDevProfile reports whether profile names a development environment.
+func isDevProfile(profile string) bool {
+	switch strings.ToLower(strings.TrimSpace(profile)) {
+	case "dev", "development", "local":
+		return true
+	default:
+		return false
+	}
+}
+
+var cors *CORSPolicy
+
+// Allowed reports whether origin may read responses.
+func (p *CORSPolicy) Allowed(origin string) bool {
+	origin = strings.ToLower(origin)
+	if origin == "" || origin == "null" {
+		return false
+	}
+
+	if slices.Contains(p.origins, origin) {
+		return true
+	}
+
+	for _, wildcard := range p.wildcards {
+		prefix, suffix := wildcard[0], wildcard[1]
+		if len(origin) <= len(prefix)+len(suffix) || !strings.HasPrefix(origin, prefix) || !strings.HasSuffix(origin, suffix) {
+			continue
+		}
+
+		if label := origin[len(prefix) : len(origin)-len(suffix)]; !strings.ContainsAny(label, "/:@?#") {
+			return true
+		}
+	}
+
+	if p.allowLocalhost {
+		if u, err := url.Parse(origin); err == nil && (u.Scheme == "http" || u.Scheme == "https") {
+			switch u.Hostname() {
+			case "localhost", "127.0.0.1", "::1":
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// addVary appends value to the Vary header in headers.
+func addVary(headers map[string]string, value string) {
+	if existing := headers["Vary"]; existing != "" {
+		headers["Vary"] = existing + ", " + value
+		return
+	}
+
+	headers["Vary"] = value
+}
+
+// exposeHeaders adds names to the Access-Control-Expose-Headers header in headers, so browsers let scripts read them.
+func exposeHeaders(headers map[string]string, names ...string) {
+	value := strings.Join(names, ", ")
+	if existing := headers["Access-Control-Expose-Headers"]; existing != "" {
+		value = existing + ", " + value
+	}
+
+	headers["Access-Control-Expose-Headers"] = value
+}
+
+// applyCORS echoes the request's Origin in headers when it is allowed. Vary: Origin is always added, since the
+// response differs by origin.
+func applyCORS(req events.APIGatewayProxyRequest, headers map[string]string) {
+	addVary(headers, "Origin")
+
+	origin := requestHeader(req, "Origin")
+	if !cors.Allowed(origin) {
+		return
+	}
+
+	headers["Access-Control-Allow-Origin"] = origin
+	headers["Access-Control-Allow-Credentials"] = "true"
+}
+
+// preflightResponse answers a CORS preflight request. The CORS headers are only granted when the origin, the
+// requested method and every requested header are allowed; otherwise the browser blocks the real request. Any origin
+// may send an API key, since the key's own allowed origins are checked on the real request.
+func preflightResponse(req events.APIGatewayProxyRequest) events.APIGatewayProxyResponse {
+	headers := map[string]string{
+		"Access-Control-Allow-Methods": strings.Join(allowedMethods, ","),
+	}
+	applyCORS(req, headers)
+	addVary(headers, "Access-Control-Request-Method")
+	addVary(headers, "Access-Control-Request-Headers")
+
+	method := requestHeader(req, "Access-Control-Request-Method")
+	requested, headersAllowed := allowedRequestHeaders(requestHeader(req, "Access-Control-Request-Headers"))
+
+	if origin := requestHeader(req, "Origin"); origin != "" && origin != "null" && auth.Enabled() &&
+		slices.Contains(requested, strings.ToLower(apiKeyHeader)) {
+		headers["Access-Control-Allow-Origin"] = origin
+		headers["Access-Control-Allow-Credentials"] = "true"
+	}
+
+	if (method != "" && !slices.Contains(allowedMethods, strings.ToUpper(method))) || !headersAllowed {
+		delete(headers, "Access-Control-Allow-Origin")
+		delete(headers, "Access-Control-Allow-Credentials")
+	}
+
+	if _, ok := headers["Access-Control-Allow-Origin"]; ok {
+		headers["Access-Control-Max-Age"] = "600"
+		if len(requested) > 0 {
+			headers["Access-Control-Allow-Headers"] = strings.Join(requested, ",")
+		}
+	}
+
+	return events.APIGatewayProxyResponse{StatusCode: http.StatusNoContent, Headers: headers}
+}
+
+// allowedRequestHeaders parses an Access-Control-Request-Headers value and reports whether every header in it is
+// allowed.
+func allowedRequestHeaders(value string) ([]string, bool) {
+	var requested []string
+	for _, header := range strings.Split(value, ",") {
+		header = strings.ToLower(strings.TrimSpace(header))
+		if header == "" {
+			continue
+		}
+
+		if !slices.Contains(corsAllowedHeaders, header) {
+			return nil, false
+		}
+
+		requested = append(requested, header)
+	}
+
+	return requested, true
+}
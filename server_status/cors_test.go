@@ -0,0 +1,168 @@
+package main
+
+import (
+	"context"
+	"github.com/aws/aws-lambda-go/events"
+	"net/http"
+	"testing"
+)
+
+func TestCORSPolicyAllowed(t *testing.T) {
+	policy := NewCORSPolicy([]string{"https://ddocompendium.com", "https://*.yourddo.com/", " "}, false)
+	dev := NewCORSPolicy([]string{"https://yourddo.com"}, true)
+
+	tests := []struct {
+		name   string
+		policy *CORSPolicy
+		origin string
+		want   bool
+	}{
+		{name: "exact match", policy: policy, origin: "https://ddocompendium.com", want: true},
+		{name: "exact match ignores case", policy: policy, origin: "https://DDOCompendium.com", want: true},
+		{name: "scheme must match", policy: policy, origin: "http://ddocompendium.com", want: false},
+		{name: "wildcard subdomain", policy: policy, origin: "https://app.yourddo.com", want: true},
+		{name: "wildcard nested subdomain", policy: policy, origin: "https://beta.app.yourddo.com", want: true},
+		{name: "wildcard excludes bare domain", policy: policy, origin: "https://yourddo.com", want: false},
+		{name: "wildcard excludes lookalike", policy: policy, origin: "https://evilyourddo.com", want: false},
+		{name: "wildcard excludes port", policy: policy, origin: "https://app.yourddo.com:8443", want: false},
+		{name: "wildcard excludes smuggled host", policy: policy, origin: "https://evil.example/.yourddo.com", want: false},
+		{name: "unlisted origin", policy: policy, origin: "https://example.com", want: false},
+		{name: "empty origin", policy: policy, origin: "", want: false},
+		{name: "null origin", policy: policy, origin: "null", want: false},
+		{name: "localhost outside dev", policy: policy, origin: "http://localhost:3000", want: false},
+		{name: "localhost in dev", policy: dev, origin: "http://localhost:3000", want: true},
+		{name: "loopback IP in dev", policy: dev, origin: "http://127.0.0.1:5173", want: true},
+		{name: "other host in dev", policy: dev, origin: "http://example.com", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.policy.Allowed(tt.origin); got != tt.want {
+				t.Errorf("Allowed(%q) = %v, want %v", tt.origin, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsDevProfile(t *testing.T) {
+	tests := []struct {
+		profile string
+		want    bool
+	}{
+		{profile: "dev", want: true},
+		{profile: "Development", want: true},
+		{profile: "local", want: true},
+		{profile: "prod", want: false},
+		{profile: "", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.profile, func(t *testing.T) {
+			if got := isDevProfile(tt.profile); got != tt.want {
+				t.Errorf("isDevProfile(%q) = %v, want %v", tt.profile, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPreflight(t *testing.T) {
+	tests := []struct {
+		name         string
+		headers      map[string]string
+		wantOrigin   string
+		wantHeaders  string
+		wantCORSVary bool
+	}{
+		{
+			name:        "allowed origin",
+			headers:     map[string]string{"Origin": "https://yourddo.com", "Access-Control-Request-Method": "GET"},
+			wantOrigin:  "https://yourddo.com",
+			wantHeaders: "",
+		},
+		{
+			name: "allowed request headers are echoed",
+			headers: map[string]string{
+				"origin":                         "https://app.yourddo.com",
+				"access-control-request-method":  "GET",
+				"access-control-request-headers": "If-None-Match, Authorization",
+			},
+			wantOrigin:  "https://app.yourddo.com",
+			wantHeaders: "if-none-match,authorization",
+		},
+		{
+			name: "disallowed request header",
+			headers: map[string]string{
+				"Origin":                         "https://yourddo.com",
+				"Access-Control-Request-Method":  "GET",
+				"Access-Control-Request-Headers": "X-Custom",
+			},
+		},
+		{
+			name:    "disallowed method",
+			headers: map[string]string{"Origin": "https://yourddo.com", "Access-Control-Request-Method": "DELETE"},
+		},
+		{
+			name:    "disallowed origin",
+			headers: map[string]string{"Origin": "https://example.com", "Access-Control-Request-Method": "GET"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := handleRequest(context.Background(), events.APIGatewayProxyRequest{
+				HTTPMethod: http.MethodOptions,
+				Path:       "/v2/server_status",
+				Headers:    tt.headers,
+			})
+			if err != nil {
+				t.Fatalf("handleRequest() error = %v", err)
+			}
+
+			if got.StatusCode != http.StatusNoContent {
+				t.Errorf("status = %v, want %v", got.StatusCode, http.StatusNoContent)
+			}
+			if got.Headers["Access-Control-Allow-Origin"] != tt.wantOrigin {
+				t.Errorf("Access-Control-Allow-Origin = %q, want %q", got.Headers["Access-Control-Allow-Origin"], tt.wantOrigin)
+			}
+			if got.Headers["Access-Control-Allow-Headers"] != tt.wantHeaders {
+				t.Errorf("Access-Control-Allow-Headers = %q, want %q", got.Headers["Access-Control-Allow-Headers"], tt.wantHeaders)
+			}
+			if want := "Origin, Access-Control-Request-Method, Access-Control-Request-Headers"; got.Headers["Vary"] != want {
+				t.Errorf("Vary = %q, want %q", got.Headers["Vary"], want)
+			}
+		})
+	}
+}
+
+func TestResponsesEchoAllowedOrigin(t *testing.T) {
+	tests := []struct {
+		name       string
+		origin     string
+		wantOrigin string
+	}{
+		{name: "allowed origin", origin: "https://ddocompendium.com", wantOrigin: "https://ddocompendium.com"},
+		{name: "disallowed origin", origin: "https://example.com", wantOrigin: ""},
+		{name: "no origin", origin: "", wantOrigin: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			headers := map[string]string{}
+			if tt.origin != "" {
+				headers["Origin"] = tt.origin
+			}
+
+			got, err := handleRequest(context.Background(), events.APIGatewayProxyRequest{Path: openAPIPath, Headers: headers})
+			if err != nil {
+				t.Fatalf("handleRequest() error = %v", err)
+			}
+
+			if got.Headers["Access-Control-Allow-Origin"] != tt.wantOrigin {
+				t.Errorf("Access-Control-Allow-Origin = %q, want %q", got.Headers["Access-Control-Allow-Origin"], tt.wantOrigin)
+			}
+			if got.Headers["Vary"] != "Origin" {
+				t.Errorf("Vary = %q, want Origin", got.Headers["Vary"])
+			}
+		})
+	}
+}
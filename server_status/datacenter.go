@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/veteran-software/yourddo-api/shared/types"
+	"sync"
+	"time"
+)
+
+var errNoDatacenters = errors.New("datacenter document lists no datacenters")
+
+// DatacenterSource fetches the datacenter document from an ordered list of mirrors, skipping mirrors whose circuit
+// is open in breaker, and keeps the last document that parsed successfully as a final fallback. With a store the
+// fallback also survives cold starts.
+type DatacenterSource struct {
+	store DatacenterStore
+
+	mu     sync.Mutex
+	last   *storedDatacenter
+	loaded bool
+}
+
+var datacenters *DatacenterSource
+
+// datacenterResult is the document a fetch produced and where it came from.
+type datacenterResult struct {
+	Document *types.ArrayOfDatacenterStruct
+	URL      string
+	// Fallback is set when every mirror failed and Document is the last good one.
+	Fallback bool
+	// FetchedAt is when Document was fetched from URL.
+	FetchedAt time.Time
+}
+
+// Fetch tries each mirror in order and returns the first usable document. When every mirror fails the last good
+// document is returned along with the joined mirror errors; err is only nil when a mirror answered.
+func (s *DatacenterSource) Fetch(ctx context.Context, urls []string) (*datacenterResult, error) {
+	logger := loggerFromContext(ctx)
+
+	var errs []error
+	for _, url := range urls {
+		if !breaker.Allow(url) {
+			errs = append(errs, fmt.Errorf("URL %s: skipped, circuit open", url))
+			continue
+		}
+
+		start := time.Now()
+		doc, err := FetchAndParseDatacenter(ctx, url)
+		if err == nil && len(doc.DatacenterStructs) == 0 {
+			err = &parseError{err: errNoDatacenters}
+		}
+		logger.Debug("datacenter fetched", "url", url, "duration_ms", time.Since(start).Milliseconds(), "error", err)
+
+		if err != nil {
+			if state := breaker.RecordFailure(url); state == circuitOpen {
+				logger.Warn("circuit open for datacenter mirror", "url", url)
+			}
+			errs = append(errs, fmt.Errorf("URL %s: %w", url, err))
+			continue
+		}
+
+		breaker.RecordSuccess(url)
+		fetched := &storedDatacenter{URL: url, FetchedAt: time.Now().UTC(), Document: doc}
+		s.remember(ctx, fetched)
+
+		return &datacenterResult{Document: doc, URL: url, FetchedAt: fetched.FetchedAt}, nil
+	}
+
+	err := errors.Join(errs...)
+
+	last := s.lastGood(ctx)
+	if last == nil {
+		return nil, err
+	}
+
+	logger.Warn("all datacenter mirrors failed, using last good document", "url", last.URL, "fetched_at", last.FetchedAt)
+
+	return &datacenterResult{Document: last.Document, URL: last.URL, Fallback: true, FetchedAt: last.FetchedAt}, err
+}
+
+// remember keeps doc in memory and writes it to the store. A failed write is logged, since the document is still
+// usable from memory.
+func (s *DatacenterSource) remember(ctx context.Context, doc *storedDatacenter) {
+	s.mu.Lock()
+	s.last = doc
+	s.loaded = true
+	s.mu.Unlock()
+
+	if s.store == nil {
+		return
+	}
+
+	if err := s.store.Save(ctx, doc); err != nil {
+		loggerFromContext(ctx).Warn("failed to persist datacenter document", "error", err)
+	}
+}
+
+// lastGood returns the last good document, reading it from the store the first time it is needed after a cold start.
+func (s *DatacenterSource) lastGood(ctx context.Context) *storedDatacenter {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.loaded && s.store != nil {
+		s.loaded = true
+
+		doc, err := s.store.Load(ctx)
+		if err != nil {
+			loggerFromContext(ctx).Warn("failed to load persisted datacenter document", "error", err)
+		}
+		s.last = doc
+	}
+
+	return s.last
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/redis/go-redis/v9"
+	"github.com/veteran-software/yourddo-api/shared/types"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// storedDatacenter is a datacenter document together with where and when it was fetched.
+type storedDatacenter struct {
+	URL       string                         `json:"url"`
+	FetchedAt time.Time                      `json:"fetchedAt"`
+	Document  *types.ArrayOfDatacenterStruct `json:"document"`
+}
+
+// DatacenterStore persists the last good datacenter document beyond the memory of a single container. Load returns
+// nil without an error when nothing has been stored yet.
+type DatacenterStore interface {
+	Load(ctx context.Context) (*storedDatacenter, error)
+	Save(ctx context.Context, doc *storedDatacenter) error
+}
+
+// FileDatacenterStore keeps the document as JSON in a single file. Writes go through a temporary file and a rename,
+// so a reader never sees a partial document. The file is only as durable as the filesystem holding it: Lambda's /tmp
+// is private to one container and lost on a cold start, so the path must be on shared storage such as an EFS mount
+// for the document to outlive the container. RedisDatacenterStore needs no such storage.
+type FileDatacenterStore struct {
+	path string
+}
+
+func NewFileDatacenterStore(path string) *FileDatacenterStore {
+	return &FileDatacenterStore{path: path}
+}
+
+// datacenterStoreFromConfig keeps the document in client, the shared Redis server, when set, and otherwise in a file
+// at path. Returns nil when neither is set.
+func datacenterStoreFromConfig(path string, client *redis.Client) DatacenterStore {
+	if client != nil {
+		return NewRedisDatacenterStore(client)
+	}
+
+	if path != "" {
+		return NewFileDatacenterStore(path)
+	}
+
+	return nil
+}
+
+func (s *FileDatacenterStore) Load(context.Context) (*storedDatacenter, error) {
+	content, err := os.ReadFile(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading datacenter cache: %w", err)
+	}
+
+	var doc storedDatacenter
+	if err := json.Unmarshal(content, &doc); err != nil {
+		return nil, fmt.Errorf("error decoding datacenter cache: %w", err)
+	}
+
+	if doc.Document == nil || len(doc.Document.DatacenterStructs) == 0 {
+		return nil, fmt.Errorf("datacenter cache %s holds no datacenters", s.path)
+	}
+
+	return &doc, nil
+}
+
+func (s *FileDatacenterStore) Save(_ context.Context, doc *storedDatacenter) error {
+	content, err := json.Marshal(doc)
+	if err != nil {
+		return fmt.Errorf("error encoding datacenter cache: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), ".datacenter-*")
+	if err != nil {
+		return fmt.Errorf("error writing datacenter cache: %w", err)
+	}
+	defer func() {
+		_ = os.Remove(tmp.Name())
+	}()
+
+	if _, err := tmp.Write(content); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("error writing datacenter cache: %w", err)
+	}
+
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("error writing datacenter cache: %w", err)
+	}
+
+	if err := os.Rename(tmp.Name(), s.path); err != nil {
+		return fmt.Errorf("error writing datacenter cache: %w", err)
+	}
+
+	return nil
+}
+
+const datacenterKey = "datacenter:last"
+
+// RedisDatacenterStore keeps the document in Redis next to the feed's transitions, so every container falls back to
+// the same document and it survives cold starts without shared storage.
+type RedisDatacenterStore struct {
+	client *redis.Client
+}
+
+func NewRedisDatacenterStore(client *redis.Client) *RedisDatacenterStore {
+	return &RedisDatacenterStore{client: client}
+}
+
+func (s *RedisDatacenterStore) Load(ctx context.Context) (*storedDatacenter, error) {
+	content, err := s.client.Get(ctx, datacenterKey).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading datacenter cache: %w", err)
+	}
+
+	var doc storedDatacenter
+	if err := json.Unmarshal(content, &doc); err != nil {
+		return nil, fmt.Errorf("error decoding datacenter cache: %w", err)
+	}
+
+	if doc.Document == nil || len(doc.Document.DatacenterStructs) == 0 {
+		return nil, fmt.Errorf("datacenter cache %s holds no datacenters", datacenterKey)
+	}
+
+	return &doc, nil
+}
+
+func (s *RedisDatacenterStore) Save(ctx context.Context, doc *storedDatacenter) error {
+	content, err := json.Marshal(doc)
+	if err != nil {
+		return fmt.Errorf("error encoding datacenter cache: %w", err)
+	}
+
+	if err := s.client.Set(ctx, datacenterKey, content, 0).Err(); err != nil {
+		return fmt.Errorf("error writing datacenter cache: %w", err)
+	}
+
+	return nil
+}
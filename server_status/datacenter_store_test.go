@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"github.com/veteran-software/yourddo-api/shared/types"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func testStoredDatacenter() *storedDatacenter {
+	return &storedDatacenter{
+		URL:       "https://gls.example/dc",
+		FetchedAt: time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC),
+		Document: &types.ArrayOfDatacenterStruct{
+			DatacenterStructs: []types.DatacenterStruct{{
+				KeyName: "DDO",
+				Datacenter: types.DatacenterWrap{
+					CachedAt: time.Date(2024, 1, 1, 11, 0, 0, 0, time.UTC),
+					Datacenter: types.DatacenterInfo{
+						Name:   "DDO",
+						Worlds: []types.World{{Name: "Argonnessen", StatusServerUrl: "http://world.example", Order: 1}},
+					},
+				},
+			}},
+		},
+	}
+}
+
+func TestFileDatacenterStore(t *testing.T) {
+	tests := []struct {
+		name     string
+		contents string
+		save     *storedDatacenter
+		want     *storedDatacenter
+		wantErr  bool
+	}{
+		{name: "nothing stored", want: nil},
+		{name: "round trip", save: testStoredDatacenter(), want: testStoredDatacenter()},
+		{name: "corrupt file", contents: "{not json", wantErr: true},
+		{name: "no datacenters", contents: `{"url":"x","document":{}}`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := NewFileDatacenterStore(filepath.Join(t.TempDir(), "datacenter.json"))
+
+			if tt.contents != "" {
+				if err := os.WriteFile(store.path, []byte(tt.contents), 0o600); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if tt.save != nil {
+				if err := store.Save(context.Background(), tt.save); err != nil {
+					t.Fatalf("Save() error = %v", err)
+				}
+			}
+
+			got, err := store.Load(context.Background())
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Load() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Load() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRedisDatacenterStore(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		save    *storedDatacenter
+		want    *storedDatacenter
+		wantErr bool
+	}{
+		{name: "nothing stored", want: nil},
+		{name: "round trip", save: testStoredDatacenter(), want: testStoredDatacenter()},
+		{name: "corrupt value", value: "{not json", wantErr: true},
+		{name: "no datacenters", value: `{"url":"x","document":{}}`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, client := newTestRedis(t)
+			store := NewRedisDatacenterStore(client)
+
+			if tt.value != "" {
+				if err := server.Set(datacenterKey, tt.value); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if tt.save != nil {
+				if err := store.Save(context.Background(), tt.save); err != nil {
+					t.Fatalf("Save() error = %v", err)
+				}
+			}
+
+			got, err := store.Load(context.Background())
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Load() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Load() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDatacenterStoreFromConfig(t *testing.T) {
+	_, client := newTestRedis(t)
+
+	if got := datacenterStoreFromConfig("", nil); got != nil {
+		t.Errorf("datacenterStoreFromConfig() = %T, want nil", got)
+	}
+	if got, ok := datacenterStoreFromConfig("/mnt/efs/datacenter.json", nil).(*FileDatacenterStore); !ok || got.path != "/mnt/efs/datacenter.json" {
+		t.Errorf("datacenterStoreFromConfig() with a path = %+v, want a file store", got)
+	}
+	if _, ok := datacenterStoreFromConfig("/mnt/efs/datacenter.json", client).(*RedisDatacenterStore); !ok {
+		t.Error("datacenterStoreFromConfig() with redis is not a redis store")
+	}
+}
+
+func TestDatacenterSourceLoadsPersistedDocument(t *testing.T) {
+	cleanup := setupEnv(t, "")
+	defer cleanup()
+
+	stores := map[string]func(t *testing.T) DatacenterStore{
+		"file": func(t *testing.T) DatacenterStore {
+			return NewFileDatacenterStore(filepath.Join(t.TempDir(), "datacenter.json"))
+		},
+		"redis": func(t *testing.T) DatacenterStore {
+			_, client := newTestRedis(t)
+			return NewRedisDatacenterStore(client)
+		},
+	}
+
+	for name, newStore := range stores {
+		t.Run(name, func(t *testing.T) {
+			store := newStore(t)
+			if err := store.Save(context.Background(), testStoredDatacenter()); err != nil {
+				t.Fatalf("Save() error = %v", err)
+			}
+
+			// A fresh source stands in for a cold start
+			source := &DatacenterSource{store: store}
+
+			got, err := source.Fetch(context.Background(), []string{invalidUrl})
+			if err == nil {
+				t.Error("Fetch() error = nil, want the mirror error")
+			}
+			if got == nil || !got.Fallback {
+				t.Fatalf("Fetch() = %+v, want the persisted document as a fallback", got)
+			}
+			if got.URL != "https://gls.example/dc" {
+				t.Errorf("Fetch() url = %v, want the persisted URL", got.URL)
+			}
+		})
+	}
+}
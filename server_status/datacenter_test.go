@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/veteran-software/yourddo-api/shared/types"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+// newCountingServer returns a server answering with body, or with a 500 when body is empty, and counts its requests.
+func newCountingServer(body string) (*httptest.Server, *atomic.Int32) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		if body == "" {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set(contentTypeKey, contentTypeValue)
+		_, _ = w.Write([]byte(body))
+	}))
+
+	return server, &requests
+}
+
+func TestDatacenterSourceFailover(t *testing.T) {
+	document := fmt.Sprintf(dcResponse, "http://world.example")
+
+	primary, primaryRequests := newCountingServer("")
+	defer primary.Close()
+
+	mirror, mirrorRequests := newCountingServer(document)
+	defer mirror.Close()
+
+	empty, _ := newCountingServer(`<ArrayOfDatacenterStruct></ArrayOfDatacenterStruct>`)
+	defer empty.Close()
+
+	tests := []struct {
+		name    string
+		mirrors []string
+		wantURL string
+		wantErr bool
+	}{
+		{name: "first mirror answers", mirrors: []string{mirror.URL, primary.URL}, wantURL: mirror.URL},
+		{name: "fails over to next mirror", mirrors: []string{primary.URL, mirror.URL}, wantURL: mirror.URL},
+		{name: "empty document fails over", mirrors: []string{empty.URL, mirror.URL}, wantURL: mirror.URL},
+		{name: "every mirror fails", mirrors: []string{primary.URL, invalidUrl}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cleanup := setupEnv(t, "")
+			defer cleanup()
+
+			got, err := datacenters.Fetch(context.Background(), tt.mirrors)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Fetch() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				if got != nil {
+					t.Errorf("Fetch() = %+v, want nil without a last good document", got)
+				}
+				return
+			}
+			if got.URL != tt.wantURL || got.Fallback {
+				t.Errorf("Fetch() url = %v, fallback = %v, want %v from a live mirror", got.URL, got.Fallback, tt.wantURL)
+			}
+		})
+	}
+
+	t.Run("open circuit skips the primary", func(t *testing.T) {
+		cleanup := setupEnv(t, "")
+		defer cleanup()
+
+		primaryRequests.Store(0)
+		mirrorRequests.Store(0)
+		mirrors := []string{primary.URL, mirror.URL}
+
+		for i := 0; i < defaultCircuitFailureThreshold+2; i++ {
+			if _, err := datacenters.Fetch(context.Background(), mirrors); err != nil {
+				t.Fatalf("Fetch() error = %v", err)
+			}
+		}
+
+		if got := primaryRequests.Load(); got != defaultCircuitFailureThreshold {
+			t.Errorf("primary requests = %d, want %d", got, defaultCircuitFailureThreshold)
+		}
+		if got := mirrorRequests.Load(); got != defaultCircuitFailureThreshold+2 {
+			t.Errorf("mirror requests = %d, want %d", got, defaultCircuitFailureThreshold+2)
+		}
+	})
+}
+
+func TestDatacenterSourceFallsBackToLastGoodDocument(t *testing.T) {
+	statusServer := newXMLTestServer(statusResponse)
+	defer statusServer.Close()
+
+	datacenterServer := newXMLTestServer(fmt.Sprintf(dcResponse, statusServer.URL))
+
+	cleanup := setupEnv(t, datacenterServer.URL)
+	defer cleanup()
+
+	if snap := fetchSnapshot(context.Background()); len(snap.Errors) != 0 {
+		t.Fatalf("first poll errors = %v, want none", snap.Errors)
+	}
+
+	datacenterServer.Close()
+
+	snap := fetchSnapshot(context.Background())
+	if len(snap.Servers) != 1 {
+		t.Fatalf("servers = %d, want the world from the last good document", len(snap.Servers))
+	}
+	if got := snap.Servers[0].State; got != types.StateOnline {
+		t.Errorf("state = %v, want %v", got, types.StateOnline)
+	}
+	if len(snap.Errors) != 1 || errorPhase(snap.Errors[0]) != phaseDatacenterFetch {
+		t.Errorf("errors = %v, want one datacenter_fetch error", snap.Errors)
+	}
+	if !snap.Datacenter.Stale {
+		t.Error("datacenter.stale = false, want true")
+	}
+	if snap.Datacenter.AgeSeconds == nil || *snap.Datacenter.AgeSeconds <= 0 {
+		t.Errorf("datacenter.ageSeconds = %v, want the age of the document's cachedAt", snap.Datacenter.AgeSeconds)
+	}
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/veteran-software/yourddo-api/shared/types"
+	"io"
+	"sync"
+	"time"
+)
+
+const emfNamespace = "YourDDO/ServerStatus"
+
+// EMFLogger writes CloudWatch Embedded Metric Format log lines, which CloudWatch turns into metrics without any API
+// calls. See https://docs.aws.amazon.com/AmazonCloudWatch/latest/monitoring/CloudWatch_Embedded_Metric_Format_Specification.html
+type EMFLogger struct {
+	mu      sync.Mutex
+	out     io.Writer
+	enabled bool
+}
+
+// NewEMFLogger returns a logger writing to out. A disabled logger discards everything.
+func NewEMFLogger(out io.Writer, enabled bool) *EMFLogger {
+	return &EMFLogger{out: out, enabled: enabled}
+}
+
+// emf is on by default inside Lambda, where stdout is shipped to CloudWatch Logs.
+var emf *EMFLogger
+
+type emfMetric struct {
+	Name string `json:"Name"`
+	Unit string `json:"Unit"`
+}
+
+type emfDirective struct {
+	Namespace  string      `json:"Namespace"`
+	Dimensions [][]string  `json:"Dimensions"`
+	Metrics    []emfMetric `json:"Metrics"`
+}
+
+type emfMetadata struct {
+	Timestamp         int64          `json:"Timestamp"`
+	CloudWatchMetrics []emfDirective `json:"CloudWatchMetrics"`
+}
+
+// write emits one EMF line. values holds both the dimension values and the metric values, keyed by name.
+func (l *EMFLogger) write(at time.Time, dimensions []string, metrics []emfMetric, values map[string]any) error {
+	if !l.enabled {
+		return nil
+	}
+
+	line := make(map[string]any, len(values)+1)
+	for key, value := range values {
+		line[key] = value
+	}
+
+	line["_aws"] = emfMetadata{
+		Timestamp: at.UnixMilli(),
+		CloudWatchMetrics: []emfDirective{{
+			Namespace:  emfNamespace,
+			Dimensions: [][]string{dimensions},
+			Metrics:    metrics,
+		}},
+	}
+
+	encoded, err := json.Marshal(line)
+	if err != nil {
+		return fmt.Errorf("error encoding EMF line: %w", err)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	_, err = fmt.Fprintf(l.out, "%s\n", encoded)
+	return err
+}
+
+// EmitSnapshot writes one line per world with its availability, upstream latency and fetch errors, dimensioned by
+// world and datacenter, plus a datacenter-level line with the total error count of the poll.
+func (l *EMFLogger) EmitSnapshot(snap *snapshot) error {
+	for _, server := range snap.Servers {
+		availability, fetchErrors := 0, 0
+		if server.State == types.StateOnline {
+			availability = 1
+		}
+		if server.State == types.StateError {
+			fetchErrors = 1
+		}
+
+		err := l.write(snap.GeneratedAt, []string{"Datacenter", "World"}, []emfMetric{
+			{Name: "Availability", Unit: "None"},
+			{Name: "UpstreamLatency", Unit: "Milliseconds"},
+			{Name: "FetchErrors", Unit: "Count"},
+		}, map[string]any{
+			"Datacenter":      snap.Datacenter.Name,
+			"World":           server.Name,
+			"Availability":    availability,
+			"UpstreamLatency": server.FetchDuration.Milliseconds(),
+			"FetchErrors":     fetchErrors,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return l.write(snap.GeneratedAt, []string{"Datacenter"}, []emfMetric{
+		{Name: "Errors", Unit: "Count"},
+		{Name: "Worlds", Unit: "Count"},
+	}, map[string]any{
+		"Datacenter": snap.Datacenter.Name,
+		"Errors":     len(snap.Errors),
+		"Worlds":     len(snap.Servers),
+	})
+}
+
+// EmitCacheResult records whether a request was answered with 304 Not Modified. The Average statistic of CacheHit
+// is the cache hit ratio.
+func (l *EMFLogger) EmitCacheResult(datacenter string, hit bool, at time.Time) error {
+	value := 0
+	if hit {
+		value = 1
+	}
+
+	return l.write(at, []string{"Datacenter"}, []emfMetric{
+		{Name: "CacheHit", Unit: "None"},
+	}, map[string]any{
+		"Datacenter": datacenter,
+		"CacheHit":   value,
+	})
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/aws/aws-lambda-go/events"
+	"io"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// captureEMF enables EMF on the real stdout for the duration of fn and returns every line written.
+func captureEMF(t *testing.T, fn func()) []map[string]any {
+	t.Helper()
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("failed to create pipe: %v", err)
+	}
+
+	stdout, previous := os.Stdout, emf
+	os.Stdout = w
+	emf = NewEMFLogger(os.Stdout, true)
+
+	defer func() {
+		os.Stdout, emf = stdout, previous
+	}()
+
+	fn()
+	_ = w.Close()
+
+	output, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("failed to read captured stdout: %v", err)
+	}
+
+	var lines []map[string]any
+	scanner := bufio.NewScanner(strings.NewReader(string(output)))
+	for scanner.Scan() {
+		var line map[string]any
+		if err := json.Unmarshal(scanner.Bytes(), &line); err != nil {
+			t.Fatalf("stdout line is not JSON: %q", scanner.Text())
+		}
+		lines = append(lines, line)
+	}
+
+	return lines
+}
+
+// emfMetricNames returns the metric names declared by an EMF line.
+func emfMetricNames(line map[string]any) []string {
+	aws := line["_aws"].(map[string]any)
+	directive := aws["CloudWatchMetrics"].([]any)[0].(map[string]any)
+
+	var names []string
+	for _, metric := range directive["Metrics"].([]any) {
+		names = append(names, metric.(map[string]any)["Name"].(string))
+	}
+
+	return names
+}
+
+func TestEMFOutput(t *testing.T) {
+	statusServer := newXMLTestServer(statusResponse)
+	defer statusServer.Close()
+
+	datacenterServer := newXMLTestServer(fmt.Sprintf(twoWorldDcResponse, statusServer.URL, invalidUrl))
+	defer datacenterServer.Close()
+
+	cleanup := setupEnv(t, datacenterServer.URL)
+	defer cleanup()
+
+	lines := captureEMF(t, func() {
+		if _, err := handleRequest(context.Background(), events.APIGatewayProxyRequest{Path: "/server_status"}); err != nil {
+			t.Fatalf("handleRequest() error = %v", err)
+		}
+	})
+
+	if len(lines) != 4 {
+		t.Fatalf("EMF lines = %v, want 2 worlds, 1 datacenter summary and 1 cache result", len(lines))
+	}
+
+	worlds := map[string]map[string]any{}
+	for _, line := range lines {
+		if world, ok := line["World"].(string); ok {
+			worlds[world] = line
+		}
+		if _, ok := line["_aws"].(map[string]any)["Timestamp"].(float64); !ok {
+			t.Errorf("line has no timestamp: %v", line)
+		}
+	}
+
+	good, bad := worlds["GoodWorld"], worlds["BadWorld"]
+	if good == nil || bad == nil {
+		t.Fatalf("missing per-world lines: %v", lines)
+	}
+
+	if good["Availability"] != float64(1) || good["FetchErrors"] != float64(0) {
+		t.Errorf("GoodWorld = %v, want available without errors", good)
+	}
+	if bad["Availability"] != float64(0) || bad["FetchErrors"] != float64(1) {
+		t.Errorf("BadWorld = %v, want unavailable with one error", bad)
+	}
+	if got := emfMetricNames(good); strings.Join(got, ",") != "Availability,UpstreamLatency,FetchErrors" {
+		t.Errorf("world metrics = %v", got)
+	}
+
+	summary := lines[2]
+	if summary["Errors"] != float64(1) || summary["Worlds"] != float64(2) {
+		t.Errorf("datacenter summary = %v, want 1 error across 2 worlds", summary)
+	}
+
+	if lines[3]["CacheHit"] != float64(0) {
+		t.Errorf("cache result = %v, want a miss", lines[3])
+	}
+}
+
+func TestEMFDisabled(t *testing.T) {
+	var out strings.Builder
+	logger := NewEMFLogger(&out, false)
+
+	if err := logger.EmitCacheResult("DDO", true, time.Now()); err != nil {
+		t.Fatalf("EmitCacheResult() error = %v", err)
+	}
+	if out.Len() != 0 {
+		t.Errorf("disabled logger wrote %q", out.String())
+	}
+}
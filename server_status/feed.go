@@ -0,0 +1,236 @@
+package main
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"github.com/aws/aws-lambda-go/events"
+	"net/http"
+	"strings"
+	"time"
+)
+
+type feedKind string
+
+const (
+	feedAtom feedKind = "atom"
+	feedRSS  feedKind = "rss"
+)
+
+const (
+	feedTitle   = "DDO Server Status Changes"
+	feedID      = "urn:yourddo:server-status:changes"
+	feedHomeURL = "https://yourddo.com"
+)
+
+// feedContentTypes is the Content-Type served for each feed kind.
+var feedContentTypes = map[feedKind]string{
+	feedAtom: "application/atom+xml; charset=utf-8",
+	feedRSS:  "application/rss+xml; charset=utf-8",
+}
+
+// feedKindFromPath reports whether a path such as "/server_status/feed.atom" asks for a feed, and which kind.
+func feedKindFromPath(path string) (feedKind, bool) {
+	switch {
+	case strings.HasSuffix(path, "/feed.atom"):
+		return feedAtom, true
+	case strings.HasSuffix(path, "/feed.rss"):
+		return feedRSS, true
+	default:
+		return "", false
+	}
+}
+
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	ID      string      `xml:"id"`
+	Title   string      `xml:"title"`
+	Updated string      `xml:"updated"`
+	Author  atomAuthor  `xml:"author"`
+	Links   []atomLink  `xml:"link"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomAuthor struct {
+	Name string `xml:"name"`
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr,omitempty"`
+}
+
+type atomEntry struct {
+	ID       string       `xml:"id"`
+	Title    string       `xml:"title"`
+	Updated  string       `xml:"updated"`
+	Summary  string       `xml:"summary"`
+	Category atomCategory `xml:"category"`
+}
+
+type atomCategory struct {
+	Term string `xml:"term,attr"`
+}
+
+type rssFeed struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	Channel rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title         string    `xml:"title"`
+	Link          string    `xml:"link"`
+	Description   string    `xml:"description"`
+	LastBuildDate string    `xml:"lastBuildDate"`
+	Items         []rssItem `xml:"item"`
+}
+
+type rssItem struct {
+	Title       string  `xml:"title"`
+	Description string  `xml:"description"`
+	Category    string  `xml:"category"`
+	GUID        rssGUID `xml:"guid"`
+	PubDate     string  `xml:"pubDate"`
+}
+
+type rssGUID struct {
+	IsPermaLink string `xml:"isPermaLink,attr"`
+	Value       string `xml:",chardata"`
+}
+
+// renderFeed renders change events, newest first, as an Atom or RSS feed. selfURL is the address the feed was
+// requested from and may be empty.
+func renderFeed(kind feedKind, changeEvents []ChangeEvent, updated time.Time, selfURL string) ([]byte, error) {
+	if len(changeEvents) > 0 {
+		updated = changeEvents[0].At
+	}
+
+	var doc any
+	switch kind {
+	case feedAtom:
+		doc = buildAtomFeed(changeEvents, updated, selfURL)
+	case feedRSS:
+		doc = buildRSSFeed(changeEvents, updated)
+	default:
+		return nil, fmt.Errorf("unsupported feed: %s", kind)
+	}
+
+	body, err := xml.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("error encoding feed: %w", err)
+	}
+
+	return append([]byte(xml.Header), body...), nil
+}
+
+func buildAtomFeed(changeEvents []ChangeEvent, updated time.Time, selfURL string) atomFeed {
+	feed := atomFeed{
+		ID:      feedID,
+		Title:   feedTitle,
+		Updated: updated.UTC().Format(time.RFC3339),
+		Author:  atomAuthor{Name: "YourDDO"},
+		Links:   []atomLink{{Href: feedHomeURL}},
+	}
+
+	if selfURL != "" {
+		feed.Links = append(feed.Links, atomLink{Href: selfURL, Rel: "self"})
+	}
+
+	for _, event := range changeEvents {
+		feed.Entries = append(feed.Entries, atomEntry{
+			ID:       event.ID,
+			Title:    changeTitle(event),
+			Updated:  event.At.Format(time.RFC3339),
+			Summary:  changeSummary(event),
+			Category: atomCategory{Term: string(event.To)},
+		})
+	}
+
+	return feed
+}
+
+func buildRSSFeed(changeEvents []ChangeEvent, updated time.Time) rssFeed {
+	feed := rssFeed{
+		Version: "2.0",
+		Channel: rssChannel{
+			Title:         feedTitle,
+			Link:          feedHomeURL,
+			Description:   "Dungeons & Dragons Online world status transitions",
+			LastBuildDate: updated.UTC().Format(time.RFC1123Z),
+		},
+	}
+
+	for _, event := range changeEvents {
+		feed.Channel.Items = append(feed.Channel.Items, rssItem{
+			Title:       changeTitle(event),
+			Description: changeSummary(event),
+			Category:    string(event.To),
+			GUID:        rssGUID{IsPermaLink: "false", Value: event.ID},
+			PubDate:     event.At.Format(time.RFC1123Z),
+		})
+	}
+
+	return feed
+}
+
+func changeTitle(event ChangeEvent) string {
+	return fmt.Sprintf("%s is now %s", event.name(), stateLabel(event.To))
+}
+
+func changeSummary(event ChangeEvent) string {
+	return fmt.Sprintf("%s changed from %s to %s at %s.",
+		event.name(), stateLabel(event.From), stateLabel(event.To), event.At.Format(time.RFC1123))
+}
+
+// serveFeed polls the worlds, so transitions since the last request are recorded, and responds with the change feed.
+func serveFeed(ctx context.Context, req events.APIGatewayProxyRequest, kind feedKind) events.APIGatewayProxyResponse {
+	snap := fetchSnapshot(ctx)
+
+	changeEvents, err := changes.Events(ctx)
+	if err != nil {
+		loggerFromContext(ctx).Error("reading changes failed", "error", err)
+		return internalServerError()
+	}
+
+	body, err := renderFeed(kind, visibleEvents(changeEvents), snap.GeneratedAt, feedURL(cfg.PublicBaseURL, kind))
+	if err != nil {
+		return internalServerError()
+	}
+
+	headers := map[string]string{
+		"Content-Type":  feedContentTypes[kind],
+		"Cache-Control": cacheControl(),
+	}
+	applyCORS(req, headers)
+
+	return events.APIGatewayProxyResponse{
+		StatusCode: http.StatusOK,
+		Headers:    headers,
+		Body:       string(body),
+	}
+}
+
+// visibleEvents drops the events of worlds that are hidden by the world overrides, including those recorded before the
+// world was hidden.
+func visibleEvents(changeEvents []ChangeEvent) []ChangeEvent {
+	visible := make([]ChangeEvent, 0, len(changeEvents))
+	for _, event := range changeEvents {
+		if override, ok := lookupOverride(cfg.WorldOverrides, event.World); ok && override.Hidden {
+			continue
+		}
+		visible = append(visible, event)
+	}
+
+	return visible
+}
+
+// feedURL returns the public URL of a feed under baseURL, or "" when no base URL is configured. The request's Host
+// header is not used, as the client controls it.
+func feedURL(baseURL string, kind feedKind) string {
+	if baseURL == "" {
+		return ""
+	}
+
+	return strings.TrimSuffix(baseURL, "/") + "/server_status/feed." + string(kind)
+}
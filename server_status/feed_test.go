@@ -0,0 +1,170 @@
+package main
+
+import (
+	"context"
+	"encoding/xml"
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/veteran-software/yourddo-api/shared/types"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testChangeEvents() []ChangeEvent {
+	at := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	return []ChangeEvent{
+		{
+			ID:          changeEventID("Argonnessen", types.StateOnline, at.Add(time.Minute)),
+			World:       "Argonnessen",
+			DisplayName: "Argonnessen (64-bit)",
+			From:        types.StateOffline,
+			To:          types.StateOnline,
+			At:          at.Add(time.Minute),
+		},
+		{
+			ID:    changeEventID("Argonnessen", types.StateOffline, at),
+			World: "Argonnessen",
+			From:  types.StateOnline,
+			To:    types.StateOffline,
+			At:    at,
+		},
+	}
+}
+
+func TestFeedKindFromPath(t *testing.T) {
+	tests := []struct {
+		path   string
+		want   feedKind
+		wantOK bool
+	}{
+		{path: "/server_status/feed.atom", want: feedAtom, wantOK: true},
+		{path: "/server_status/feed.rss", want: feedRSS, wantOK: true},
+		{path: "/server_status", wantOK: false},
+		{path: "/server_status/feed.json", wantOK: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			got, ok := feedKindFromPath(tt.path)
+			if got != tt.want || ok != tt.wantOK {
+				t.Errorf("feedKindFromPath(%q) = %v, %v, want %v, %v", tt.path, got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestRenderAtomFeed(t *testing.T) {
+	body, err := renderFeed(feedAtom, testChangeEvents(), time.Now(), "https://api.test/server_status/feed.atom")
+	if err != nil {
+		t.Fatalf("renderFeed() error = %v", err)
+	}
+
+	var feed atomFeed
+	if err := xml.Unmarshal(body, &feed); err != nil {
+		t.Fatalf("rendered Atom does not parse: %v", err)
+	}
+
+	if len(feed.Entries) != 2 {
+		t.Fatalf("entries = %v, want 2", len(feed.Entries))
+	}
+	if feed.Updated != "2024-01-01T12:01:00Z" {
+		t.Errorf("updated = %q, want newest event time", feed.Updated)
+	}
+	if feed.Entries[0].Title != "Argonnessen (64-bit) is now Online" {
+		t.Errorf("entry title = %q", feed.Entries[0].Title)
+	}
+	if feed.Entries[0].ID != testChangeEvents()[0].ID {
+		t.Errorf("entry id = %q, want the stable event ID", feed.Entries[0].ID)
+	}
+}
+
+func TestRenderRSSFeed(t *testing.T) {
+	body, err := renderFeed(feedRSS, testChangeEvents(), time.Now(), "")
+	if err != nil {
+		t.Fatalf("renderFeed() error = %v", err)
+	}
+
+	var feed rssFeed
+	if err := xml.Unmarshal(body, &feed); err != nil {
+		t.Fatalf("rendered RSS does not parse: %v", err)
+	}
+
+	if len(feed.Channel.Items) != 2 {
+		t.Fatalf("items = %v, want 2", len(feed.Channel.Items))
+	}
+
+	if !strings.HasPrefix(feed.Channel.Items[0].Description, "Argonnessen (64-bit) changed") {
+		t.Errorf("description = %q, want the display name", feed.Channel.Items[0].Description)
+	}
+
+	// Events recorded without a display name fall back to the world name
+	item := feed.Channel.Items[1]
+	if item.Title != "Argonnessen is now Offline" {
+		t.Errorf("title = %q, want the world name", item.Title)
+	}
+	if item.GUID.IsPermaLink != "false" || item.GUID.Value != testChangeEvents()[1].ID {
+		t.Errorf("guid = %+v, want the stable event ID", item.GUID)
+	}
+	if item.Category != string(types.StateOffline) {
+		t.Errorf("category = %q, want offline", item.Category)
+	}
+}
+
+func TestHandleRequestFeed(t *testing.T) {
+	cleanup := setupEnv(t, "")
+	defer cleanup()
+
+	useConfig(t, func(c *Config) {
+		c.PublicBaseURL = "https://api.yourddo.com/"
+	})
+
+	got, err := handleRequest(context.Background(), events.APIGatewayProxyRequest{
+		Path:    "/server_status/feed.atom",
+		Headers: map[string]string{"Host": "attacker.example", "Origin": "https://ddocompendium.com"},
+	})
+	if err != nil {
+		t.Fatalf("handleRequest() error = %v", err)
+	}
+
+	if got.StatusCode != http.StatusOK {
+		t.Errorf("status = %v, want %v", got.StatusCode, http.StatusOK)
+	}
+	if got.Headers["Content-Type"] != feedContentTypes[feedAtom] {
+		t.Errorf("Content-Type = %q", got.Headers["Content-Type"])
+	}
+	if got.Headers["Access-Control-Allow-Origin"] != "https://ddocompendium.com" {
+		t.Errorf("CORS origin = %q", got.Headers["Access-Control-Allow-Origin"])
+	}
+	if !strings.Contains(got.Body, `href="https://api.yourddo.com/server_status/feed.atom" rel="self"`) {
+		t.Errorf("feed is missing its self link:\n%s", got.Body)
+	}
+	if strings.Contains(got.Body, "attacker.example") {
+		t.Errorf("feed links to the Host header:\n%s", got.Body)
+	}
+}
+
+func TestVisibleEvents(t *testing.T) {
+	useOverrides(t, `{"Lamannia": {"hidden": true}}`)
+
+	at := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	changeEvents := []ChangeEvent{
+		{World: "Lamannia", To: types.StateOnline, At: at},
+		{World: "Argonnessen", To: types.StateOnline, At: at},
+	}
+
+	got := visibleEvents(changeEvents)
+	if len(got) != 1 || got[0].World != "Argonnessen" {
+		t.Errorf("visibleEvents() = %+v, want only Argonnessen", got)
+	}
+}
+
+func TestFeedURL(t *testing.T) {
+	if got := feedURL("", feedAtom); got != "" {
+		t.Errorf("feedURL() without a base URL = %q, want none", got)
+	}
+	if got := feedURL("https://api.yourddo.com/prod", feedRSS); got != "https://api.yourddo.com/prod/server_status/feed.rss" {
+		t.Errorf("feedURL() = %q", got)
+	}
+}
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/xml"
+	"fmt"
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/veteran-software/yourddo-api/shared/types"
+	"mime"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+type outputFormat string
+
+const (
+	formatJSON outputFormat = "json"
+	formatXML  outputFormat = "xml"
+	formatCSV  outputFormat = "csv"
+	formatText outputFormat = "text"
+)
+
+// formatContentTypes is the Content-Type served for each output format.
+var formatContentTypes = map[outputFormat]string{
+	formatJSON: "application/json",
+	formatXML:  "application/xml; charset=utf-8",
+	formatCSV:  "text/csv; charset=utf-8",
+	formatText: "text/plain; charset=utf-8",
+}
+
+// formatsByName maps ?format= values to output formats.
+var formatsByName = map[string]outputFormat{
+	"json": formatJSON,
+	"xml":  formatXML,
+	"csv":  formatCSV,
+	"text": formatText,
+	"txt":  formatText,
+}
+
+// formatsByMediaType maps Accept media ranges to output formats. Wildcards resolve to the default for their range.
+var formatsByMediaType = map[string]outputFormat{
+	"application/json": formatJSON,
+	"text/json":        formatJSON,
+	"application/xml":  formatXML,
+	"text/xml":         formatXML,
+	"text/csv":         formatCSV,
+	"text/plain":       formatText,
+	"text/*":           formatText,
+	"application/*":    formatJSON,
+	"*/*":              formatJSON,
+}
+
+// negotiateFormat picks the output format from ?format=, falling back to the Accept header and then JSON. The media
+// range the client prefers most, the most specific one among equal q values, decides the format when this API can
+// produce it. When it cannot, as with a browser asking for text/html first, a wildcard covering JSON still gets JSON,
+// and otherwise the best format the client accepts is used. Returns false when the client only accepts formats this
+// API cannot produce.
+func negotiateFormat(req events.APIGatewayProxyRequest) (outputFormat, bool) {
+	if name := req.QueryStringParameters["format"]; name != "" {
+		format, ok := formatsByName[strings.ToLower(name)]
+		return format, ok
+	}
+
+	accept := requestHeader(req, "Accept")
+	if strings.TrimSpace(accept) == "" {
+		return formatJSON, true
+	}
+
+	type mediaRange struct {
+		mediaType string
+		q         float64
+	}
+
+	var ranges []mediaRange
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+
+		q := 1.0
+		if value, ok := params["q"]; ok {
+			if parsed, err := strconv.ParseFloat(value, 64); err == nil {
+				q = parsed
+			}
+		}
+
+		if q > 0 {
+			ranges = append(ranges, mediaRange{mediaType: mediaType, q: q})
+		}
+	}
+
+	sort.SliceStable(ranges, func(i, j int) bool {
+		if ranges[i].q != ranges[j].q {
+			return ranges[i].q > ranges[j].q
+		}
+		return specificity(ranges[i].mediaType) > specificity(ranges[j].mediaType)
+	})
+
+	if len(ranges) == 0 {
+		return "", false
+	}
+
+	if format, ok := formatsByMediaType[ranges[0].mediaType]; ok {
+		return format, true
+	}
+
+	for _, r := range ranges {
+		if r.mediaType == "*/*" || r.mediaType == "application/*" {
+			return formatJSON, true
+		}
+	}
+
+	for _, r := range ranges {
+		if format, ok := formatsByMediaType[r.mediaType]; ok {
+			return format, true
+		}
+	}
+
+	return "", false
+}
+
+// specificity ranks a media range: a full type above a subtype wildcard above */*.
+func specificity(mediaType string) int {
+	switch {
+	case mediaType == "*/*":
+		return 0
+	case strings.HasSuffix(mediaType, "/*"):
+		return 1
+	default:
+		return 2
+	}
+}
+
+// xmlResponse is the XML representation of the v1 response.
+type xmlResponse struct {
+	XMLName xml.Name            `xml:"serverStatus"`
+	Servers []*types.ServerInfo `xml:"servers>server"`
+	Errors  []string            `xml:"errors>error"`
+}
+
+// renderServers renders the server list in a non-JSON format.
+func renderServers(format outputFormat, servers []*types.ServerInfo, errors []string) ([]byte, error) {
+	switch format {
+	case formatXML:
+		return renderXML(servers, errors)
+	case formatCSV:
+		return renderCSV(servers)
+	case formatText:
+		return renderText(servers)
+	default:
+		return nil, fmt.Errorf("unsupported format: %s", format)
+	}
+}
+
+func renderXML(servers []*types.ServerInfo, errors []string) ([]byte, error) {
+	body, err := xml.MarshalIndent(xmlResponse{Servers: servers, Errors: errors}, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("error encoding XML: %w", err)
+	}
+
+	return append([]byte(xml.Header), body...), nil
+}
+
+func renderCSV(servers []*types.ServerInfo) ([]byte, error) {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+
+	rows := [][]string{{"name", "commonName", "status", "order", "state", "lastKnownStatus", "lastKnownAt", "error", "displayName"}}
+	for _, server := range servers {
+		lastKnownStatus, lastKnownAt := "", ""
+		if server.LastKnownStatus != nil {
+			lastKnownStatus = strconv.FormatBool(*server.LastKnownStatus)
+		}
+		if server.LastKnownAt != nil {
+			lastKnownAt = server.LastKnownAt.Format(time.RFC3339)
+		}
+
+		rows = append(rows, []string{
+			server.Name,
+			server.CommonName,
+			strconv.FormatBool(server.Status),
+			strconv.Itoa(server.Order),
+			string(server.State),
+			lastKnownStatus,
+			lastKnownAt,
+			server.Error,
+			server.DisplayName,
+		})
+	}
+
+	if err := w.WriteAll(rows); err != nil {
+		return nil, fmt.Errorf("error encoding CSV: %w", err)
+	}
+
+	return buf.Bytes(), nil
+}
+
+// renderText renders a compact table suitable for forum signatures and terminals.
+func renderText(servers []*types.ServerInfo) ([]byte, error) {
+	var buf bytes.Buffer
+	w := tabwriter.NewWriter(&buf, 0, 0, 2, ' ', 0)
+
+	_, _ = fmt.Fprintln(w, "WORLD\tSTATUS")
+	for _, server := range servers {
+		_, _ = fmt.Fprintf(w, "%s\t%s\n", displayName(server), stateLabel(server.State))
+	}
+
+	if err := w.Flush(); err != nil {
+		return nil, fmt.Errorf("error encoding text: %w", err)
+	}
+
+	return buf.Bytes(), nil
+}
+
+// stateLabel is the human-readable form of a server state.
+func stateLabel(state types.ServerState) string {
+	switch state {
+	case types.StateOnline:
+		return "Online"
+	case types.StateOffline:
+		return "Offline"
+	case types.StateError:
+		return "Error"
+	default:
+		return "Unknown"
+	}
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/xml"
+	"fmt"
+	"github.com/aws/aws-lambda-go/events"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestNegotiateFormat(t *testing.T) {
+	tests := []struct {
+		name   string
+		accept string
+		query  string
+		want   outputFormat
+		wantOK bool
+	}{
+		{name: "no preference", want: formatJSON, wantOK: true},
+		{name: "json", accept: "application/json", want: formatJSON, wantOK: true},
+		{name: "xml", accept: "application/xml", want: formatXML, wantOK: true},
+		{name: "csv", accept: "text/csv", want: formatCSV, wantOK: true},
+		{name: "plain text", accept: "text/plain", want: formatText, wantOK: true},
+		{name: "browser default", accept: "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8", want: formatJSON, wantOK: true},
+		{
+			name:   "chrome navigation",
+			accept: "text/html,application/xhtml+xml,application/xml;q=0.9,image/avif,image/webp,image/apng,*/*;q=0.8,application/signed-exchange;v=b3;q=0.7",
+			want:   formatJSON,
+			wantOK: true,
+		},
+		{name: "fetch default", accept: "*/*", want: formatJSON, wantOK: true},
+		{name: "xml preferred over a wildcard", accept: "application/xml, */*;q=0.8", want: formatXML, wantOK: true},
+		{name: "specific type on a tie", accept: "*/*, text/csv", want: formatCSV, wantOK: true},
+		{name: "unsupported preference without a wildcard", accept: "text/html, text/csv;q=0.5", want: formatCSV, wantOK: true},
+		{name: "quality ordering", accept: "text/csv;q=0.5, text/plain;q=0.9", want: formatText, wantOK: true},
+		{name: "excluded type", accept: "text/csv;q=0, application/json;q=0.1", want: formatJSON, wantOK: true},
+		{name: "wildcard", accept: "*/*", want: formatJSON, wantOK: true},
+		{name: "unsupported", accept: "image/png", wantOK: false},
+		{name: "query overrides accept", accept: "application/json", query: "csv", want: formatCSV, wantOK: true},
+		{name: "query alias", query: "TXT", want: formatText, wantOK: true},
+		{name: "unsupported query", query: "yaml", wantOK: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := events.APIGatewayProxyRequest{Headers: map[string]string{"Accept": tt.accept}}
+			if tt.query != "" {
+				req.QueryStringParameters = map[string]string{"format": tt.query}
+			}
+
+			got, ok := negotiateFormat(req)
+			if ok != tt.wantOK || (ok && got != tt.want) {
+				t.Errorf("negotiateFormat() = %v, %v, want %v, %v", got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestRenderServers(t *testing.T) {
+	snap := goldenSnapshot()
+	snap.Servers[1].DisplayName = "Cannith (Hardcore)"
+	v1 := buildV1Response(snap)
+
+	t.Run("xml", func(t *testing.T) {
+		body, err := renderServers(formatXML, v1.Servers, v1.Errors)
+		if err != nil {
+			t.Fatalf("renderServers() error = %v", err)
+		}
+
+		var decoded xmlResponse
+		if err := xml.Unmarshal(body, &decoded); err != nil {
+			t.Fatalf("rendered XML does not parse: %v", err)
+		}
+		if len(decoded.Servers) != 3 || decoded.Servers[2].State != "error" || len(decoded.Errors) != 1 {
+			t.Errorf("decoded XML = %+v, want 3 servers and 1 error", decoded)
+		}
+		if decoded.Servers[1].DisplayName != "Cannith (Hardcore)" {
+			t.Errorf("displayName = %q, want the overridden name", decoded.Servers[1].DisplayName)
+		}
+	})
+
+	t.Run("csv", func(t *testing.T) {
+		body, err := renderServers(formatCSV, v1.Servers, v1.Errors)
+		if err != nil {
+			t.Fatalf("renderServers() error = %v", err)
+		}
+
+		records, err := csv.NewReader(strings.NewReader(string(body))).ReadAll()
+		if err != nil {
+			t.Fatalf("rendered CSV does not parse: %v", err)
+		}
+		if len(records) != 4 {
+			t.Fatalf("CSV rows = %v, want header and 3 servers", len(records))
+		}
+		if records[1][0] != "Argonnessen" || records[3][5] != "true" || records[2][8] != "Cannith (Hardcore)" {
+			t.Errorf("unexpected CSV rows: %v", records)
+		}
+	})
+
+	t.Run("text", func(t *testing.T) {
+		body, err := renderServers(formatText, v1.Servers, v1.Errors)
+		if err != nil {
+			t.Fatalf("renderServers() error = %v", err)
+		}
+
+		lines := strings.Split(strings.TrimSpace(string(body)), "\n")
+		if len(lines) != 4 {
+			t.Fatalf("text lines = %v, want header and 3 servers", len(lines))
+		}
+		if !strings.HasPrefix(lines[1], "Argonnessen") || !strings.HasSuffix(lines[1], "Online") {
+			t.Errorf("unexpected text row: %q", lines[1])
+		}
+		if !strings.HasPrefix(lines[2], "Cannith (Hardcore)") {
+			t.Errorf("text row = %q, want the display name", lines[2])
+		}
+	})
+}
+
+func TestHandleRequestFormats(t *testing.T) {
+	statusServer := newXMLTestServer(statusResponse)
+	defer statusServer.Close()
+
+	datacenterServer := newXMLTestServer(fmt.Sprintf(dcResponse, statusServer.URL))
+	defer datacenterServer.Close()
+
+	cleanup := setupEnv(t, datacenterServer.URL)
+	defer cleanup()
+
+	tests := []struct {
+		name            string
+		req             events.APIGatewayProxyRequest
+		wantStatus      int
+		wantContentType string
+	}{
+		{
+			name:            "csv by query",
+			req:             events.APIGatewayProxyRequest{QueryStringParameters: map[string]string{"format": "csv"}},
+			wantStatus:      http.StatusOK,
+			wantContentType: "text/csv; charset=utf-8",
+		},
+		{
+			name:            "xml by accept",
+			req:             events.APIGatewayProxyRequest{Headers: map[string]string{"Accept": "application/xml"}},
+			wantStatus:      http.StatusOK,
+			wantContentType: "application/xml; charset=utf-8",
+		},
+		{
+			name:       "unsupported",
+			req:        events.APIGatewayProxyRequest{Headers: map[string]string{"Accept": "application/pdf"}},
+			wantStatus: http.StatusNotAcceptable,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := handleRequest(context.Background(), tt.req)
+			if err != nil {
+				t.Fatalf("handleRequest() error = %v", err)
+			}
+
+			if got.StatusCode != tt.wantStatus {
+				t.Errorf("status = %v, want %v", got.StatusCode, tt.wantStatus)
+			}
+			if tt.wantContentType != "" && got.Headers["Content-Type"] != tt.wantContentType {
+				t.Errorf("Content-Type = %q, want %q", got.Headers["Content-Type"], tt.wantContentType)
+			}
+			if got.Headers["Vary"] != "Accept, Origin" {
+				t.Errorf("Vary = %q, want Accept, Origin", got.Headers["Vary"])
+			}
+		})
+	}
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/veteran-software/yourddo-api/shared/types"
+	"io"
+	"net/http"
+	"runtime/debug"
+	"sync"
+	"time"
+)
+
+const (
+	healthPath             = "/health"
+	upstreamCheckTimeout   = 3 * time.Second
+	dependencyCheckTimeout = time.Second
+)
+
+// version is set at build time with -ldflags "-X main.version=...". When empty the VCS revision is used instead.
+var version = ""
+
+// buildVersion returns the version reported by /health.
+func buildVersion() string {
+	if version != "" {
+		return version
+	}
+
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, setting := range info.Settings {
+			if setting.Key == "vcs.revision" && len(setting.Value) >= 12 {
+				return setting.Value[:12]
+			}
+		}
+	}
+
+	return "dev"
+}
+
+// pollState records when this container last completed each part of a poll successfully.
+type pollState struct {
+	mu                    sync.RWMutex
+	lastDatacenterSuccess time.Time
+	lastSnapshot          time.Time
+}
+
+var polls = &pollState{}
+
+func (p *pollState) RecordDatacenterSuccess(at time.Time) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.lastDatacenterSuccess = at
+}
+
+func (p *pollState) RecordSnapshot(at time.Time) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.lastSnapshot = at
+}
+
+func (p *pollState) get() (lastDatacenterSuccess, lastSnapshot time.Time) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	return p.lastDatacenterSuccess, p.lastSnapshot
+}
+
+// checkUpstream makes a single request to the datacenter endpoint without parsing the response. Any response below
+// 500 counts as reachable.
+func checkUpstream(ctx context.Context, target string) types.UpstreamHealth {
+	ctx, cancel := context.WithTimeout(ctx, upstreamCheckTimeout)
+	defer cancel()
+
+	start := time.Now()
+	health := types.UpstreamHealth{}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		health.Error = err.Error()
+		return health
+	}
+
+	resp, err := upstreamClient.Do(req)
+	health.LatencyMs = time.Since(start).Milliseconds()
+	if err != nil {
+		health.Error = err.Error()
+		return health
+	}
+	defer func() {
+		_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 1<<16))
+		_ = resp.Body.Close()
+	}()
+
+	if resp.StatusCode >= http.StatusInternalServerError {
+		health.Error = fmt.Sprintf("unexpected status code: %d", resp.StatusCode)
+		return health
+	}
+
+	health.Reachable = true
+	return health
+}
+
+// checkMirrors checks the datacenter mirrors in order and reports the first one that is reachable, or the error of
+// the last one when none are.
+func checkMirrors(ctx context.Context, mirrors []string) types.UpstreamHealth {
+	var health types.UpstreamHealth
+	for _, mirror := range mirrors {
+		if health = checkUpstream(ctx, mirror); health.Reachable {
+			return health
+		}
+	}
+
+	return health
+}
+
+// checkDependency runs check against one of the API's dependencies and reports the outcome.
+func checkDependency(ctx context.Context, name string, check func(context.Context) error) types.DependencyHealth {
+	ctx, cancel := context.WithTimeout(ctx, dependencyCheckTimeout)
+	defer cancel()
+
+	start := time.Now()
+	err := check(ctx)
+	health := types.DependencyHealth{Name: name, OK: err == nil, LatencyMs: time.Since(start).Milliseconds()}
+	if err != nil {
+		health.Error = err.Error()
+	}
+
+	return health
+}
+
+// checkAPIKeys reads the API keys file again, so a file that has become unreadable or invalid since the cold start is
+// reported before the next cold start fails on it.
+func checkAPIKeys(context.Context) error {
+	_, err := loadAPIKeys(cfg.Auth.KeysPath)
+	return err
+}
+
+// checkDependencies checks the dependencies the API is configured with: the API keys file, which must still load, and
+// the Redis server holding rate limits, quotas and transitions, which must answer a PING.
+func checkDependencies(ctx context.Context) []types.DependencyHealth {
+	dependencies := []types.DependencyHealth{}
+
+	if cfg.Auth.KeysPath != "" {
+		dependencies = append(dependencies, checkDependency(ctx, "apiKeys", checkAPIKeys))
+	}
+
+	if redisClient != nil {
+		dependencies = append(dependencies, checkDependency(ctx, "redis", func(ctx context.Context) error {
+			return redisClient.Ping(ctx).Err()
+		}))
+	}
+
+	return dependencies
+}
+
+// checkHealth builds the health report and the HTTP status it is served with: 200 when healthy, 503 when only the
+// game's servers are unreachable and 500 when one of the API's own dependencies is failing.
+func checkHealth(ctx context.Context) (types.HealthResponse, int) {
+	now := time.Now().UTC()
+	report := types.HealthResponse{
+		Status:       types.HealthOK,
+		Version:      buildVersion(),
+		Dependencies: checkDependencies(ctx),
+		CheckedAt:    now,
+	}
+
+	lastDatacenterSuccess, lastSnapshot := polls.get()
+	if !lastDatacenterSuccess.IsZero() {
+		report.LastDatacenterSuccess = &lastDatacenterSuccess
+	}
+	if !lastSnapshot.IsZero() {
+		age := now.Sub(lastSnapshot).Seconds()
+		report.CacheAgeSeconds = &age
+	}
+
+	report.Upstream = checkMirrors(ctx, cfg.DatacenterURLs)
+
+	for _, dependency := range report.Dependencies {
+		if !dependency.OK {
+			report.Status = types.HealthAPIError
+			return report, http.StatusInternalServerError
+		}
+	}
+
+	if !report.Upstream.Reachable {
+		report.Status = types.HealthUpstreamDown
+		return report, http.StatusServiceUnavailable
+	}
+
+	return report, http.StatusOK
+}
+
+// serveHealth responds with the health report. It never polls the worlds.
+func serveHealth(ctx context.Context) events.APIGatewayProxyResponse {
+	report, status := checkHealth(ctx)
+
+	body, err := json.Marshal(report)
+	if err != nil {
+		return internalServerError()
+	}
+
+	return events.APIGatewayProxyResponse{
+		StatusCode: status,
+		Headers: map[string]string{
+			"Content-Type":  "application/json",
+			"Cache-Control": "no-store",
+		},
+		Body: string(body),
+	}
+}
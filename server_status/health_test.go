@@ -0,0 +1,215 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/veteran-software/yourddo-api/shared/types"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestConfigValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		envURL  string
+		wantErr bool
+	}{
+		{name: "valid", envURL: "https://example.com/datacenter", wantErr: false},
+		{name: "missing", envURL: "", wantErr: true},
+		{name: "not a URL", envURL: "not a url", wantErr: true},
+		{name: "unsupported scheme", envURL: "ftp://example.com/datacenter", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cleanup := setupEnv(t, tt.envURL)
+			defer cleanup()
+
+			if got := cfg.Validate(); (len(got) > 0) != tt.wantErr {
+				t.Errorf("Validate() = %v, wantErr %v", got, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestServeHealth(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer upstream.Close()
+
+	broken := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer broken.Close()
+
+	tests := []struct {
+		name          string
+		envURL        string
+		wantStatus    int
+		wantHealth    string
+		wantReachable bool
+	}{
+		{name: "healthy", envURL: upstream.URL, wantStatus: http.StatusOK, wantHealth: types.HealthOK, wantReachable: true},
+		{name: "upstream error", envURL: broken.URL, wantStatus: http.StatusServiceUnavailable, wantHealth: types.HealthUpstreamDown},
+		{name: "upstream unreachable", envURL: invalidUrl, wantStatus: http.StatusServiceUnavailable, wantHealth: types.HealthUpstreamDown},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cleanup := setupEnv(t, tt.envURL)
+			defer cleanup()
+
+			got, err := handleRequest(context.Background(), events.APIGatewayProxyRequest{HTTPMethod: http.MethodGet, Path: healthPath})
+			if err != nil {
+				t.Fatalf("handleRequest() error = %v", err)
+			}
+
+			if got.StatusCode != tt.wantStatus {
+				t.Errorf("status = %v, want %v", got.StatusCode, tt.wantStatus)
+			}
+
+			var report types.HealthResponse
+			if err := json.Unmarshal([]byte(got.Body), &report); err != nil {
+				t.Fatalf("Failed to unmarshal response: %v", err)
+			}
+
+			if report.Status != tt.wantHealth {
+				t.Errorf("status field = %q, want %q", report.Status, tt.wantHealth)
+			}
+			if report.Upstream.Reachable != tt.wantReachable {
+				t.Errorf("upstream.reachable = %v, want %v", report.Upstream.Reachable, tt.wantReachable)
+			}
+			if report.Dependencies == nil {
+				t.Error("dependencies is null, want a list")
+			}
+			if report.Version == "" {
+				t.Error("version is empty")
+			}
+		})
+	}
+}
+
+func TestServeHealthDependencies(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer upstream.Close()
+
+	keysPath := writeConfigFile(t, "keys.json", `[{"id": "a", "hash": "`+hashAPIKey("key")+`", "tier": "free"}]`)
+
+	tests := []struct {
+		name       string
+		setup      func(t *testing.T)
+		wantStatus int
+		wantHealth string
+		want       map[string]bool
+	}{
+		{name: "none configured", setup: func(*testing.T) {}, wantStatus: http.StatusOK, wantHealth: types.HealthOK, want: map[string]bool{}},
+		{
+			name: "API keys load",
+			setup: func(t *testing.T) {
+				useConfig(t, func(c *Config) {
+					c.Auth.KeysPath = keysPath
+				})
+			},
+			wantStatus: http.StatusOK,
+			wantHealth: types.HealthOK,
+			want:       map[string]bool{"apiKeys": true},
+		},
+		{
+			name: "API keys removed",
+			setup: func(t *testing.T) {
+				// The file was removed after the cold start
+				path := writeConfigFile(t, "keys.json", "[]")
+				useConfig(t, func(c *Config) {
+					c.Auth.KeysPath = path
+				})
+				if err := os.Remove(path); err != nil {
+					t.Fatal(err)
+				}
+			},
+			wantStatus: http.StatusInternalServerError,
+			wantHealth: types.HealthAPIError,
+			want:       map[string]bool{"apiKeys": false},
+		},
+		{
+			name: "redis answers",
+			setup: func(t *testing.T) {
+				_, client := newTestRedis(t)
+				useRedisClient(t, client)
+			},
+			wantStatus: http.StatusOK,
+			wantHealth: types.HealthOK,
+			want:       map[string]bool{"redis": true},
+		},
+		{
+			name: "redis down",
+			setup: func(t *testing.T) {
+				server, client := newTestRedis(t)
+				server.Close()
+				useRedisClient(t, client)
+			},
+			wantStatus: http.StatusInternalServerError,
+			wantHealth: types.HealthAPIError,
+			want:       map[string]bool{"redis": false},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cleanup := setupEnv(t, upstream.URL)
+			defer cleanup()
+
+			tt.setup(t)
+
+			report, status := checkHealth(context.Background())
+			if status != tt.wantStatus || report.Status != tt.wantHealth {
+				t.Errorf("checkHealth() = %v %q, want %v %q", status, report.Status, tt.wantStatus, tt.wantHealth)
+			}
+
+			got := make(map[string]bool, len(report.Dependencies))
+			for _, dependency := range report.Dependencies {
+				got[dependency.Name] = dependency.OK
+				if !dependency.OK && dependency.Error == "" {
+					t.Errorf("dependency %s failed without an error", dependency.Name)
+				}
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("dependencies = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHealthReportsPollTimes(t *testing.T) {
+	statusServer := newXMLTestServer(statusResponse)
+	defer statusServer.Close()
+
+	datacenterServer := newXMLTestServer(fmt.Sprintf(dcResponse, statusServer.URL))
+	defer datacenterServer.Close()
+
+	cleanup := setupEnv(t, datacenterServer.URL)
+	defer cleanup()
+
+	polls = &pollState{}
+	fetchSnapshot(context.Background())
+
+	report, status := checkHealth(context.Background())
+	if status != http.StatusOK {
+		t.Fatalf("status = %v, want %v", status, http.StatusOK)
+	}
+
+	if report.LastDatacenterSuccess == nil || time.Since(*report.LastDatacenterSuccess) > time.Minute {
+		t.Errorf("lastDatacenterSuccess = %v, want a recent time", report.LastDatacenterSuccess)
+	}
+	if report.CacheAgeSeconds == nil || *report.CacheAgeSeconds < 0 {
+		t.Errorf("cacheAgeSeconds = %v, want a non-negative age", report.CacheAgeSeconds)
+	}
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"context"
+	"github.com/veteran-software/yourddo-api/shared/types"
+	"math"
+	"slices"
+	"sync"
+	"time"
+)
+
+const (
+	latencySampleSize    = 128
+	minHedgeSamples      = 10
+	defaultHedgeMinDelay = 100 * time.Millisecond
+)
+
+// latencyTracker keeps the most recent successful fetch durations.
+type latencyTracker struct {
+	mu      sync.Mutex
+	samples []time.Duration
+	next    int
+}
+
+func (l *latencyTracker) Observe(d time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if len(l.samples) < latencySampleSize {
+		l.samples = append(l.samples, d)
+		return
+	}
+
+	l.samples[l.next] = d
+	l.next = (l.next + 1) % latencySampleSize
+}
+
+// Percentile returns the p-th percentile of the recorded durations, or false while there are too few samples.
+func (l *latencyTracker) Percentile(p float64) (time.Duration, bool) {
+	l.mu.Lock()
+	sorted := slices.Clone(l.samples)
+	l.mu.Unlock()
+
+	if len(sorted) < minHedgeSamples {
+		return 0, false
+	}
+
+	slices.Sort(sorted)
+	index := int(math.Ceil(p/100*float64(len(sorted)))) - 1
+
+	return sorted[max(0, min(index, len(sorted)-1))], true
+}
+
+// Hedger sends a second request for a world whose fetch is slower than the given percentile of recent fetches and
+// uses whichever response arrives first.
+type Hedger struct {
+	percentile float64
+	minDelay   time.Duration
+	latencies  *latencyTracker
+}
+
+func NewHedger(percentile float64, minDelay time.Duration) *Hedger {
+	return &Hedger{
+		percentile: percentile,
+		minDelay:   minDelay,
+		latencies:  &latencyTracker{},
+	}
+}
+
+// newHedgerFromConfig returns a hedger for the hedge configuration, or nil when hedging is off.
+func newHedgerFromConfig(c HedgeConfig) *Hedger {
+	if c.Percentile <= 0 || c.Percentile >= 100 {
+		return nil
+	}
+
+	return NewHedger(c.Percentile, c.MinDelay.Duration)
+}
+
+var hedger *Hedger
+
+// delay returns how long to wait before hedging, or false while there is not enough latency history.
+func (h *Hedger) delay() (time.Duration, bool) {
+	d, ok := h.latencies.Percentile(h.percentile)
+	if !ok {
+		return 0, false
+	}
+
+	return max(d, h.minDelay), true
+}
+
+type attemptResult struct {
+	status *types.Status
+	err    error
+	hedge  bool
+}
+
+// Fetch calls fetch for url, hedging it once if it is still running after the hedge delay. A nil Hedger fetches
+// without hedging.
+func (h *Hedger) Fetch(ctx context.Context, url string, fetch func(context.Context, string) (*types.Status, error)) (*types.Status, error) {
+	if h == nil {
+		return fetch(ctx, url)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	results := make(chan attemptResult, 2)
+	attempt := func(hedge bool) {
+		start := time.Now()
+		status, err := fetch(ctx, url)
+		if err == nil {
+			h.latencies.Observe(time.Since(start))
+		}
+		results <- attemptResult{status: status, err: err, hedge: hedge}
+	}
+
+	go attempt(false)
+
+	delay, ok := h.delay()
+	if !ok {
+		result := <-results
+		return result.status, result.err
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case result := <-results:
+		return result.status, result.err
+	case <-timer.C:
+	}
+
+	metrics.IncHedge()
+	go attempt(true)
+
+	first := <-results
+	if first.err != nil {
+		// The other attempt may still succeed
+		second := <-results
+		if second.err == nil {
+			first = second
+		}
+	}
+
+	if first.err == nil && first.hedge {
+		metrics.IncHedgeWin()
+	}
+
+	return first.status, first.err
+}
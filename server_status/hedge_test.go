@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"github.com/veteran-software/yourddo-api/shared/types"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestLatencyTrackerPercentile(t *testing.T) {
+	tests := []struct {
+		name       string
+		samples    int
+		percentile float64
+		want       time.Duration
+		wantOK     bool
+	}{
+		{name: "too few samples", samples: minHedgeSamples - 1, percentile: 95, wantOK: false},
+		{name: "median", samples: 100, percentile: 50, want: 50 * time.Millisecond, wantOK: true},
+		{name: "p95", samples: 100, percentile: 95, want: 95 * time.Millisecond, wantOK: true},
+		{name: "keeps only recent samples", samples: latencySampleSize + 100, percentile: 1, want: 102 * time.Millisecond, wantOK: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := &latencyTracker{}
+			for i := 1; i <= tt.samples; i++ {
+				l.Observe(time.Duration(i) * time.Millisecond)
+			}
+
+			got, ok := l.Percentile(tt.percentile)
+			if ok != tt.wantOK {
+				t.Fatalf("Percentile() ok = %v, want %v", ok, tt.wantOK)
+			}
+			if ok && got != tt.want {
+				t.Errorf("Percentile() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewHedgerFromConfig(t *testing.T) {
+	tests := []struct {
+		name       string
+		percentile float64
+		wantNil    bool
+	}{
+		{name: "off", percentile: 0, wantNil: true},
+		{name: "enabled", percentile: 95, wantNil: false},
+		{name: "out of range", percentile: 100, wantNil: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := newHedgerFromConfig(HedgeConfig{Percentile: tt.percentile}); (got == nil) != tt.wantNil {
+				t.Errorf("newHedgerFromConfig() = %v, wantNil %v", got, tt.wantNil)
+			}
+		})
+	}
+}
+
+// newSlowFirstServer returns a status server that answers its first request after delay and every later one at once.
+func newSlowFirstServer(delay time.Duration) (*httptest.Server, *atomic.Int32) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) == 1 {
+			select {
+			case <-time.After(delay):
+			case <-r.Context().Done():
+				return
+			}
+		}
+		w.Header().Set(contentTypeKey, contentTypeValue)
+		_, _ = w.Write([]byte(statusResponse))
+	}))
+
+	return server, &requests
+}
+
+func TestHedgerFetch(t *testing.T) {
+	errFetch := errors.New("fetch failed")
+
+	tests := []struct {
+		name          string
+		firstDelay    time.Duration
+		fetch         func(context.Context, string) (*types.Status, error)
+		wantErr       bool
+		wantRequests  int32
+		wantHedges    uint64
+		wantHedgeWins uint64
+	}{
+		{name: "fast response is not hedged", firstDelay: 0, fetch: FetchAndParseStatus, wantRequests: 1},
+		{name: "slow response is hedged", firstDelay: 2 * time.Second, fetch: FetchAndParseStatus, wantRequests: 2, wantHedges: 1, wantHedgeWins: 1},
+		{
+			name:       "fast failure is not hedged",
+			firstDelay: 0,
+			fetch: func(ctx context.Context, url string) (*types.Status, error) {
+				return nil, errFetch
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, requests := newSlowFirstServer(tt.firstDelay)
+			defer server.Close()
+
+			previous := metrics
+			metrics = NewMetrics()
+			t.Cleanup(func() {
+				metrics = previous
+			})
+
+			h := NewHedger(95, 20*time.Millisecond)
+			for i := 0; i < minHedgeSamples; i++ {
+				h.latencies.Observe(5 * time.Millisecond)
+			}
+
+			start := time.Now()
+			status, err := h.Fetch(context.Background(), server.URL, tt.fetch)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Fetch() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && status == nil {
+				t.Fatal("Fetch() returned nil status")
+			}
+			if elapsed := time.Since(start); elapsed > time.Second {
+				t.Errorf("Fetch() took %v, want the fastest response", elapsed)
+			}
+			if got := requests.Load(); got != tt.wantRequests {
+				t.Errorf("upstream requests = %d, want %d", got, tt.wantRequests)
+			}
+			if metrics.hedges != tt.wantHedges || metrics.hedgeWins != tt.wantHedgeWins {
+				t.Errorf("hedges = %d, wins = %d, want %d and %d", metrics.hedges, metrics.hedgeWins, tt.wantHedges, tt.wantHedgeWins)
+			}
+		})
+	}
+}
+
+func TestNilHedgerFetchesOnce(t *testing.T) {
+	server, requests := newSlowFirstServer(0)
+	defer server.Close()
+
+	var h *Hedger
+	if _, err := h.Fetch(context.Background(), server.URL, FetchAndParseStatus); err != nil {
+		t.Fatalf("Fetch() error = %v", err)
+	}
+	if got := requests.Load(); got != 1 {
+		t.Errorf("upstream requests = %d, want 1", got)
+	}
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// knownStatus is the last successfully fetched state of a single world.
+type knownStatus struct {
+	CommonName string
+	Status     bool
+	At         time.Time
+}
+
+// LastKnownStore keeps the last good status of each world, keyed by StatusServerUrl, for the lifetime of a warm container.
+type LastKnownStore struct {
+	mu       sync.RWMutex
+	statuses map[string]knownStatus
+}
+
+func NewLastKnownStore() *LastKnownStore {
+	return &LastKnownStore{
+		statuses: make(map[string]knownStatus),
+	}
+}
+
+// lastKnown is shared across invocations so failed worlds can still report their previous state.
+var lastKnown = NewLastKnownStore()
+
+// Get returns the last good status recorded for the given URL, if any.
+func (s *LastKnownStore) Get(url string) (knownStatus, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	status, ok := s.statuses[url]
+	return status, ok
+}
+
+// Set records a successful status for the given URL.
+func (s *LastKnownStore) Set(url string, status knownStatus) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.statuses[url] = status
+}
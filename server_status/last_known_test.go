@@ -0,0 +1,25 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLastKnownStore(t *testing.T) {
+	store := NewLastKnownStore()
+
+	if _, ok := store.Get("http://missing"); ok {
+		t.Error("Get() found a status that was never set")
+	}
+
+	want := knownStatus{CommonName: "Thelanis", Status: true, At: time.Now()}
+	store.Set("http://thelanis", want)
+
+	got, ok := store.Get("http://thelanis")
+	if !ok {
+		t.Fatal("Get() did not find stored status")
+	}
+	if got != want {
+		t.Errorf("Get() = %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambdacontext"
+	"io"
+	"log/slog"
+)
+
+type loggerKey struct{}
+
+// newLogger returns a JSON logger writing to out at the given level.
+func newLogger(out io.Writer, level slog.Leveler) *slog.Logger {
+	return slog.New(slog.NewJSONHandler(out, &slog.HandlerOptions{Level: level}))
+}
+
+// logLevel returns the configured minimum log level, defaulting to info.
+func logLevel() slog.Level {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(cfg.LogLevel)); err != nil {
+		return slog.LevelInfo
+	}
+
+	return level
+}
+
+// contextWithLogger returns a copy of ctx carrying logger.
+func contextWithLogger(ctx context.Context, logger *slog.Logger) context.Context {
+	return context.WithValue(ctx, loggerKey{}, logger)
+}
+
+// loggerFromContext returns the request-scoped logger stored in ctx, or the default logger.
+func loggerFromContext(ctx context.Context) *slog.Logger {
+	if logger, ok := ctx.Value(loggerKey{}).(*slog.Logger); ok {
+		return logger
+	}
+
+	return slog.Default()
+}
+
+// requestLogger returns a logger that tags every line with the Lambda and API Gateway request IDs of req.
+func requestLogger(ctx context.Context, req events.APIGatewayProxyRequest) *slog.Logger {
+	logger := loggerFromContext(ctx)
+
+	if lc, ok := lambdacontext.FromContext(ctx); ok && lc.AwsRequestID != "" {
+		logger = logger.With("lambda_request_id", lc.AwsRequestID)
+	}
+
+	if req.RequestContext.RequestID != "" {
+		logger = logger.With("apigw_request_id", req.RequestContext.RequestID)
+	}
+
+	return logger.With("method", req.HTTPMethod, "path", req.Path)
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambdacontext"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestLogLevel(t *testing.T) {
+	tests := []struct {
+		value string
+		want  slog.Level
+	}{
+		{value: "", want: slog.LevelInfo},
+		{value: "debug", want: slog.LevelDebug},
+		{value: "WARN", want: slog.LevelWarn},
+		{value: "error", want: slog.LevelError},
+		{value: "verbose", want: slog.LevelInfo},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			useConfig(t, func(c *Config) {
+				c.LogLevel = tt.value
+			})
+
+			if got := logLevel(); got != tt.want {
+				t.Errorf("logLevel() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHandleRequestLogsCorrelationIDs(t *testing.T) {
+	cleanup := setupEnv(t, "")
+	defer cleanup()
+
+	var buf bytes.Buffer
+	ctx := contextWithLogger(context.Background(), newLogger(&buf, slog.LevelDebug))
+	ctx = lambdacontext.NewContext(ctx, &lambdacontext.LambdaContext{AwsRequestID: "lambda-123"})
+
+	req := events.APIGatewayProxyRequest{Path: "/server_status", HTTPMethod: "GET"}
+	req.RequestContext.RequestID = "apigw-456"
+
+	if _, err := handleRequest(ctx, req); err != nil {
+		t.Fatalf("handleRequest() error = %v", err)
+	}
+
+	messages := map[string]map[string]any{}
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var entry map[string]any
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Fatalf("log line is not JSON: %q", line)
+		}
+
+		if entry["lambda_request_id"] != "lambda-123" || entry["apigw_request_id"] != "apigw-456" {
+			t.Errorf("log line is missing request IDs: %v", entry)
+		}
+
+		messages[entry["msg"].(string)] = entry
+	}
+
+	if upstream := messages["upstream error"]; upstream == nil || upstream["phase"] != phaseConfig {
+		t.Errorf("configuration error not logged: %v", messages)
+	}
+	if completed := messages["request completed"]; completed == nil || completed["status"] != float64(200) {
+		t.Errorf("request completion not logged: %v", messages)
+	}
+}
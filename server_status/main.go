@@ -3,199 +3,504 @@ package main
 import (
 	"bytes"
 	"context"
-	"encoding/json"
 	"encoding/xml"
+	"errors"
 	"fmt"
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/aws/aws-lambda-go/lambda"
 	"github.com/veteran-software/yourddo-api/shared/types"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"golang.org/x/net/html/charset"
 	"io"
+	"log/slog"
 	"net/http"
 	"os"
 	"sort"
 	"strings"
+	"time"
 )
 
 var allowedMethods = []string{http.MethodGet, http.MethodOptions}
 
 // handleRequest handles incoming API Gateway requests to fetch server statuses and return responses with proper CORS headers.
 func handleRequest(ctx context.Context, req events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	ctx, span := tracer.Start(extractTraceContext(ctx, req), "handleRequest",
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(
+			attribute.String("http.request.method", req.HTTPMethod),
+			attribute.String("url.path", req.Path),
+		),
+	)
+	defer flushTracing(ctx)
+
+	logger := requestLogger(ctx, req)
+	if spanContext := span.SpanContext(); spanContext.IsValid() {
+		logger = logger.With("trace_id", spanContext.TraceID().String())
+	}
+	ctx = contextWithLogger(ctx, logger)
+
+	start := time.Now()
+	resp, err := routeRequest(ctx, req)
+	if err != nil {
+		logger.Error("request failed", "error", err, "duration_ms", time.Since(start).Milliseconds())
+		endSpan(span, err)
+		return resp, err
+	}
+
+	span.SetAttributes(attribute.Int("http.response.status_code", resp.StatusCode))
+	injectTraceHeaders(ctx, &resp)
+	endSpan(span, nil)
+
+	logger.Info("request completed", "status", resp.StatusCode, "duration_ms", time.Since(start).Milliseconds())
+
+	return resp, nil
+}
+
+// routeRequest dispatches a request to the handler for its method and path.
+func routeRequest(ctx context.Context, req events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
 	method := strings.ToUpper(req.HTTPMethod)
 	if method == "" {
 		method = http.MethodGet
 	}
 
 	if strings.EqualFold(method, http.MethodOptions) {
-		return events.APIGatewayProxyResponse{
-			StatusCode: http.StatusNoContent,
-			Headers: map[string]string{
-				"Access-Control-Allow-Origin":      corsOrigin(req.Path),
-				"Access-Control-Allow-Methods":     strings.Join(allowedMethods, ","),
-				"Access-Control-Allow-Headers":     "Content-Type,Authorization",
-				"Access-Control-Allow-Credentials": "true",
-			},
-		}, nil
+		return preflightResponse(req), nil
 	}
 
 	if !strings.EqualFold(method, http.MethodGet) {
 		return events.APIGatewayProxyResponse{StatusCode: http.StatusMethodNotAllowed}, nil
 	}
 
-	servers, errors := fetchServerStatus(ctx)
+	if isOpenAPIPath(req.Path) {
+		return serveOpenAPI(req), nil
+	}
+
+	if kind, ok := feedKindFromPath(stripVersion(req.Path)); ok {
+		return serveAuthorized(ctx, req, func(ctx context.Context) events.APIGatewayProxyResponse {
+			return serveFeed(ctx, req, kind)
+		}), nil
+	}
+
+	if stripVersion(req.Path) == healthPath {
+		return serveLimited(ctx, req, serveHealth), nil
+	}
+
+	if stripVersion(req.Path) == metricsPath {
+		return serveLimited(ctx, req, serveMetrics), nil
+	}
+
+	if world, ok := badgeWorldFromPath(stripVersion(req.Path)); ok {
+		return serveAuthorized(ctx, req, func(ctx context.Context) events.APIGatewayProxyResponse {
+			return serveBadge(ctx, req, world)
+		}), nil
+	}
 
-	errorStrings := make([]string, 0, len(errors))
-	for _, err := range errors {
-		errorStrings = append(errorStrings, err.Error())
+	version, ok := apiVersionFromPath(req.Path)
+	if !ok {
+		return events.APIGatewayProxyResponse{StatusCode: http.StatusNotFound}, nil
 	}
 
-	response := types.Response{
-		Servers: servers,
-		Errors:  errorStrings,
+	return serveAuthorized(ctx, req, func(ctx context.Context) events.APIGatewayProxyResponse {
+		return serveStatus(ctx, req, version)
+	}), nil
+}
+
+// serveStatus responds with the world status in the requested API version and the negotiated format.
+func serveStatus(ctx context.Context, req events.APIGatewayProxyRequest, version apiVersion) events.APIGatewayProxyResponse {
+	format, ok := negotiateFormat(req)
+	if !ok {
+		headers := map[string]string{
+			"Content-Type": "text/plain; charset=utf-8",
+			"Vary":         "Accept",
+		}
+		applyCORS(req, headers)
+
+		return events.APIGatewayProxyResponse{
+			StatusCode: http.StatusNotAcceptable,
+			Headers:    headers,
+			Body:       "Not Acceptable: supported formats are json, xml, csv and text",
+		}
 	}
 
-	jsonResponse, err := json.Marshal(response)
+	snap := fetchSnapshot(ctx)
+
+	hash, err := contentHash(version, format, snap)
 	if err != nil {
+		return internalServerError()
+	}
+
+	etag := weakETag(version, format, hash)
+	lastModified := tracker.observe(fmt.Sprintf("v%d-%s", version, format), hash, snap.GeneratedAt)
+
+	headers := map[string]string{
+		"Cache-Control": cacheControl(),
+		"ETag":          etag,
+		"Last-Modified": lastModified.Format(http.TimeFormat),
+		"Vary":          "Accept",
+	}
+	applyCORS(req, headers)
+
+	cacheHit := notModified(req, etag, lastModified)
+	_ = emf.EmitCacheResult(snap.Datacenter.Name, cacheHit, snap.GeneratedAt)
+
+	if cacheHit {
 		return events.APIGatewayProxyResponse{
-			StatusCode: 500,
-			Body:       "Internal Server Error",
-		}, nil
+			StatusCode: http.StatusNotModified,
+			Headers:    headers,
+		}
+	}
+
+	body, err := renderResponse(version, format, snap)
+	if err != nil {
+		return internalServerError()
 	}
 
+	headers["Content-Type"] = formatContentTypes[format]
+
 	return events.APIGatewayProxyResponse{
 		StatusCode: http.StatusOK,
-		Headers: map[string]string{
-			"Content-Type":                "application/json",
-			"Access-Control-Allow-Origin": corsOrigin(req.Path),
-		},
-		Body: string(jsonResponse),
-	}, nil
+		Headers:    headers,
+		Body:       string(body),
+	}
+}
+
+// internalServerError is returned when a response cannot be encoded.
+func internalServerError() events.APIGatewayProxyResponse {
+	return events.APIGatewayProxyResponse{
+		StatusCode: http.StatusInternalServerError,
+		Body:       "Internal Server Error",
+	}
 }
 
 // FetchAndParseDatacenter fetches XML data from the given URL and parses it into a structured ArrayOfDatacenterStruct.
 // Returns the parsed data or an error if the request fails or the data cannot be parsed.
-func FetchAndParseDatacenter(url string) (*types.ArrayOfDatacenterStruct, error) {
-	resp, err := http.Get(url)
+func FetchAndParseDatacenter(ctx context.Context, url string) (result *types.ArrayOfDatacenterStruct, err error) {
+	ctx, span := tracer.Start(ctx, "fetch datacenter", trace.WithAttributes(attribute.String("url.full", url)))
+	defer func() {
+		endSpan(span, err)
+	}()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
 	if err != nil {
 		return nil, fmt.Errorf("error fetching data: %w", err)
 	}
-	defer func(Body io.ReadCloser) {
-		err := Body.Close()
-		if err != nil {
-			panic(err)
-		}
-	}(resp.Body)
+
+	resp, err := upstreamClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching data: %w", err)
+	}
+	defer closeBody(ctx, resp.Body, url, &err)
 
 	if resp.StatusCode != http.StatusOK {
 		return nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
 	}
 
-	return ParseDatacenterXML(resp.Body)
+	body, err := readUpstreamBody(resp, upstreamLimits.MaxBodyBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	_, parseSpan := tracer.Start(ctx, "parse datacenter")
+	result, err = ParseDatacenterXML(bytes.NewReader(body))
+	endSpan(parseSpan, err)
+	if err != nil {
+		return nil, &parseError{err: err}
+	}
+
+	return result, nil
 }
 
 // FetchAndParseStatus retrieves an XML status document from the given URL, parses it, and returns a Status struct.
 // Returns an error if the request fails, the response cannot be read, or parsing fails.
 // Retrieves and decodes the XML into the types.Status struct while ensuring proper charset handling.
-func FetchAndParseStatus(url string) (*types.Status, error) {
-	resp, err := http.Get(url)
+func FetchAndParseStatus(ctx context.Context, url string) (result *types.Status, err error) {
+	ctx, span := tracer.Start(ctx, "fetch world status", trace.WithAttributes(attribute.String("url.full", url)))
+	defer func() {
+		endSpan(span, err)
+	}()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
 	if err != nil {
 		return nil, fmt.Errorf("failed to fetch status: %w", err)
 	}
-	defer func(Body io.ReadCloser) {
-		err := Body.Close()
-		if err != nil {
-			panic(err)
-		}
-	}(resp.Body)
 
-	body, err := io.ReadAll(resp.Body)
+	resp, err := upstreamClient.Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read response body: %w", err)
+		return nil, fmt.Errorf("failed to fetch status: %w", err)
+	}
+	defer closeBody(ctx, resp.Body, url, &err)
+
+	// An error page is an upstream failure worth retrying, not a malformed document
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+
+	body, err := readUpstreamBody(resp, upstreamLimits.MaxBodyBytes)
+	if err != nil {
+		return nil, err
 	}
 
 	body = bytes.TrimSpace(body)
 
+	_, parseSpan := tracer.Start(ctx, "parse world status")
+
 	var status types.Status
 	decoder := xml.NewDecoder(bytes.NewReader(body))
 	decoder.CharsetReader = charset.NewReaderLabel // Handle potential charset issues
 
-	if err := decoder.Decode(&status); err != nil {
-		return nil, fmt.Errorf("failed to parse XML: %w", err)
+	err = decoder.Decode(&status)
+	endSpan(parseSpan, err)
+	if err != nil {
+		return nil, &parseError{err: fmt.Errorf("failed to parse XML: %w", err)}
 	}
 
 	return &status, nil
 }
 
+// closeBody closes an upstream response body. A close error is joined into *err when the fetch has already failed,
+// and only logged otherwise, since the document was read successfully.
+func closeBody(ctx context.Context, body io.Closer, url string, err *error) {
+	closeErr := body.Close()
+	if closeErr == nil {
+		return
+	}
+
+	if *err != nil {
+		*err = errors.Join(*err, fmt.Errorf("error closing response body: %w", closeErr))
+		return
+	}
+
+	loggerFromContext(ctx).Warn("failed to close response body", "url", url, "error", closeErr)
+}
+
 // fetchServerStatus retrieves server information and status from a datacenter URL and returns a list of servers with errors.
 func fetchServerStatus(ctx context.Context) ([]*types.ServerInfo, []error) {
-	url := os.Getenv("DATACENTER_URL")
-	if url == "" {
-		return nil, []error{fmt.Errorf("DATACENTER_URL environment variable is not set")}
+	snap := fetchSnapshot(ctx)
+
+	return snap.Servers, snap.Errors
+}
+
+// fetchSnapshot polls the datacenter and every world it lists, returning everything the versioned responses are built from.
+func fetchSnapshot(ctx context.Context) *snapshot {
+	logger := loggerFromContext(ctx)
+	start := time.Now()
+	snap := &snapshot{GeneratedAt: start.UTC()}
+
+	defer func() {
+		for _, err := range snap.Errors {
+			phase := errorPhase(err)
+			metrics.IncFetchError(phase)
+
+			attrs := []any{"phase", phase, "error", err}
+			var apiErr *APIError
+			if errors.As(err, &apiErr) && apiErr.World != "" {
+				attrs = append(attrs, "world", apiErr.World)
+			}
+			logger.Warn("upstream error", attrs...)
+		}
+
+		_ = emf.EmitSnapshot(snap)
+
+		logger.Info("poll completed",
+			"datacenter", snap.Datacenter.Name,
+			"worlds", len(snap.Servers),
+			"errors", len(snap.Errors),
+			"duration_ms", time.Since(start).Milliseconds(),
+		)
+	}()
+
+	mirrors := cfg.DatacenterURLs
+	if len(mirrors) == 0 {
+		snap.Errors = []error{&APIError{Code: CodeConfigMissing, Err: errDatacenterURLNotSet}}
+		return snap
 	}
 
-	result, err := FetchAndParseDatacenter(url)
+	source, err := datacenters.Fetch(ctx, mirrors)
 	if err != nil {
-		return nil, []error{err}
+		snap.Errors = []error{&APIError{Code: datacenterErrorCode(err), Err: err}}
+		if source == nil {
+			return snap
+		}
+	}
+
+	if !source.Fallback {
+		polls.RecordDatacenterSuccess(source.FetchedAt)
+	}
+
+	datacenter := source.Document.DatacenterStructs[0].Datacenter
+	snap.Datacenter = types.DatacenterSummary{
+		Name:     datacenter.Datacenter.Name,
+		CachedAt: datacenter.CachedAt,
+		Stale:    source.Fallback,
+	}
+	if !datacenter.CachedAt.IsZero() {
+		age := snap.GeneratedAt.Sub(datacenter.CachedAt).Seconds()
+		snap.Datacenter.AgeSeconds = &age
 	}
 
-	worldInfo := make(map[string]*types.World)
+	worlds := make([]types.World, 0, len(datacenter.Datacenter.Worlds))
+	for _, world := range datacenter.Datacenter.Worlds {
+		if override, ok := lookupOverride(cfg.WorldOverrides, world.Name); ok && override.Hidden {
+			continue
+		}
+		worlds = append(worlds, world)
+	}
+	worldNames := make(map[string]string, len(worlds))
+
 	var urls []string
-	for _, world := range result.DatacenterStructs[0].Datacenter.Datacenter.Worlds {
-		worldInfo[world.StatusServerUrl] = &world
+	for _, world := range worlds {
+		worldNames[world.StatusServerUrl] = world.Name
+		if !breaker.Allow(world.StatusServerUrl) {
+			logger.Debug("skipping world with open circuit", "world", world.Name, "url", world.StatusServerUrl)
+			continue
+		}
 		urls = append(urls, world.StatusServerUrl)
 	}
 
-	pool := NewWorkerPool(len(urls), 0)
+	pool := NewWorkerPool(min(cfg.WorkerConcurrency, len(urls)), cfg.Upstream.Retries)
 	results := pool.ProcessURLs(ctx, urls)
 
-	serverInfos := make([]*types.ServerInfo, 0, len(urls))
-	var errors []error
+	workerResults := make(map[string]types.WorkerResult, len(urls))
 
 	for result := range results {
+		if result.Error == nil {
+			breaker.RecordSuccess(result.URL)
+		} else if state := breaker.RecordFailure(result.URL); state == circuitOpen {
+			logger.Warn("circuit open for world", "world", worldNames[result.URL], "url", result.URL)
+		}
+
 		if result.Error != nil {
-			errors = append(errors, fmt.Errorf("URL %s: %w", result.URL, result.Error))
-			continue
+			snap.Errors = append(snap.Errors, &APIError{
+				Code:  worldErrorCode(result.Error),
+				World: worldNames[result.URL],
+				URL:   result.URL,
+				Err:   result.Error,
+			})
 		}
 
-		if result.Status == nil {
-			continue
+		workerResults[result.URL] = result
+	}
+
+	snap.Servers = make([]*types.ServerInfo, 0, len(worlds))
+	polled := make([]string, 0, len(worlds))
+	for _, world := range worlds {
+		result, ok := workerResults[world.StatusServerUrl]
+		info := buildServerInfo(world, result, ok)
+		if override, found := lookupOverride(cfg.WorldOverrides, world.Name); found {
+			override.apply(info)
 		}
+		metrics.ObserveWorld(info)
+		polled = append(polled, info.Name)
+		logger.Debug("world polled", "world", info.Name, "state", info.State, "duration_ms", info.FetchDuration.Milliseconds())
+		snap.Servers = append(snap.Servers, info)
+	}
+
+	metrics.RetainWorlds(polled)
+
+	sort.SliceStable(snap.Servers, func(i, j int) bool {
+		return snap.Servers[i].Order < snap.Servers[j].Order
+	})
+
+	if err := changes.Record(ctx, snap.Servers, snap.GeneratedAt); err != nil {
+		logger.Warn("recording changes failed", "error", err)
+	}
+	polls.RecordSnapshot(snap.GeneratedAt)
+
+	return snap
+}
+
+// buildServerInfo converts a world and its worker result into a ServerInfo. Worlds without a usable result are still
+// reported, with an unknown or error state and their last known status if one was recorded in this container.
+func buildServerInfo(world types.World, result types.WorkerResult, ok bool) *types.ServerInfo {
+	info := &types.ServerInfo{
+		Name:       world.Name,
+		CommonName: world.Name,
+		Order:      world.Order,
+		State:      types.StateUnknown,
+		Language:   world.Language,
+		CheckedAt:  time.Now().UTC(),
+	}
 
-		world := worldInfo[result.URL]
+	if ok {
+		info.FetchDuration = result.Duration
+	}
 
-		isActive := true
-		if result.Status.AllowBillingRole == "" {
-			isActive = false
-		} else {
-			roles := strings.Split(result.Status.AllowBillingRole, ",")
-			isActive = len(roles) >= 5
+	if ok && result.Error == nil && result.Status != nil {
+		info.CommonName = result.Status.Name
+		info.Status = isWorldActive(result.Status)
+		info.Queue = parseQueueInfo(result.Status)
+		info.State = types.StateOffline
+		if info.Status {
+			info.State = types.StateOnline
 		}
 
-		serverInfos = append(serverInfos, &types.ServerInfo{
-			Name:       world.Name,
-			CommonName: result.Status.Name,
-			Status:     isActive,
-			Order:      world.Order,
+		lastKnown.Set(world.StatusServerUrl, knownStatus{
+			CommonName: info.CommonName,
+			Status:     info.Status,
+			At:         info.CheckedAt,
 		})
+
+		return info
 	}
 
-	sort.Slice(serverInfos, func(i, j int) bool {
-		return serverInfos[i].Order < serverInfos[j].Order
-	})
+	if ok && result.Error != nil {
+		info.State = types.StateError
+		info.Error = result.Error.Error()
+		info.ErrorCode = worldErrorCode(result.Error)
+	}
+
+	if known, found := lastKnown.Get(world.StatusServerUrl); found {
+		info.CommonName = known.CommonName
+		info.LastKnownStatus = &known.Status
+		info.LastKnownAt = &known.At
+	}
 
-	return serverInfos, errors
+	return info
 }
 
-// corsOrigin determines the CORS origin URL based on the provided path. Returns a specific URL for "/server_status".
-func corsOrigin(path string) string {
-	if path == "/server_status" {
-		return "https://ddocompendium.com"
+// isWorldActive reports whether a world is accepting players, based on the billing roles it currently allows.
+func isWorldActive(status *types.Status) bool {
+	if status.AllowBillingRole == "" {
+		return false
 	}
 
-	return "https://yourddo.com"
+	roles := strings.Split(status.AllowBillingRole, ",")
+	return len(roles) >= 5
 }
 
 // main is the entry point of the application, initializing the Lambda function and starting the request handler.
+// When LISTEN_ADDR is set the handler is served over plain HTTP on that address instead. An invalid configuration
+// stops the function at cold start, with one log line per invalid setting.
 func main() {
+	slog.SetDefault(newLogger(os.Stderr, logLevel()))
+
+	ctx, cancel := context.WithTimeout(context.Background(), configLoadTimeout)
+	loaded, err := LoadConfig(ctx, os.LookupEnv)
+	cancel()
+
+	if err != nil {
+		for _, err := range configErrors(err) {
+			slog.Error("invalid configuration", "error", err)
+		}
+		os.Exit(1)
+	}
+
+	applyConfig(loaded)
+	slog.SetDefault(newLogger(os.Stderr, logLevel()))
+
+	if err := initTracing(context.Background()); err != nil {
+		slog.Error("tracing disabled", "error", err)
+	}
+
+	if addr := cfg.ListenAddr; addr != "" {
+		slog.Info("starting standalone server", "addr", addr)
+		if err := newStandaloneServer(addr).ListenAndServe(); err != nil {
+			slog.Error("standalone server stopped", "error", err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	lambda.Start(handleRequest)
 }
@@ -3,21 +3,32 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/veteran-software/yourddo-api/shared/types"
+	"io"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"reflect"
+	"strings"
 	"testing"
+	"time"
 )
 
 const contentTypeKey = "Content-Type"
 const contentTypeValue = "application/xml"
-const DatacenterUrl = "DATACENTER_URL"
 const invalidUrl = "http://invalid-url"
 
+func TestMain(m *testing.M) {
+	// The fixture servers listen on loopback, which the upstream policy blocks by default
+	upstreamPolicy.AllowedHosts = []string{anyPublicHost}
+	upstreamPolicy.AllowPrivate = true
+
+	os.Exit(m.Run())
+}
+
 // Helper function to create a test server with static XML response
 func newXMLTestServer(responseBody string) *httptest.Server {
 	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -56,28 +67,17 @@ var dcResponse = `
         </DatacenterStruct>
     </ArrayOfDatacenterStruct>`
 
-func setEnvVar(key, value string) error {
-	return os.Setenv(key, value)
-}
-
-func unsetEnvVar(key string) error {
-	return os.Unsetenv(key)
-}
-
 func setupEnv(t *testing.T, envURL string) func() {
-	if envURL != "" {
-		if err := setEnvVar(DatacenterUrl, envURL); err != nil {
-			t.Fatal(err)
-		}
-	} else {
-		if err := unsetEnvVar(DatacenterUrl); err != nil {
-			t.Fatal(err)
-		}
+	// Failures and fallback documents must not carry over between tests that share fixture URLs
+	breaker = NewCircuitBreaker(defaultCircuitFailureThreshold, defaultCircuitCooldownSeconds*time.Second)
+	datacenters = &DatacenterSource{}
+
+	previous := cfg.DatacenterURLs
+	if err := setList(&cfg.DatacenterURLs)(envURL); err != nil {
+		t.Fatal(err)
 	}
 	return func() {
-		if envURL != "" {
-			_ = unsetEnvVar(DatacenterUrl)
-		}
+		cfg.DatacenterURLs = previous
 	}
 }
 
@@ -190,61 +190,19 @@ func TestFetchServerStatus(t *testing.T) {
 		})
 	}
 }
-func TestCorsOrigin(t *testing.T) {
-	tests := []struct {
-		name     string
-		path     string
-		expected string
-	}{
-		{
-			name:     "server status path",
-			path:     "/server_status",
-			expected: "https://ddocompendium.com",
-		},
-		{
-			name:     "other path",
-			path:     "/random_path",
-			expected: "https://yourddo.com",
-		},
-		{
-			name:     "empty path",
-			path:     "",
-			expected: "https://yourddo.com",
-		},
-	}
-
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			got := corsOrigin(tt.path)
-			if got != tt.expected {
-				t.Errorf("corsOrigin(%q) = %q, want %q", tt.path, got, tt.expected)
-			}
-		})
-	}
-}
 func runTest(t *testing.T, tt struct {
 	name        string
 	envURL      string
 	wantServers int
 	wantErrors  int
 }) {
-	if tt.envURL != "" {
-		err := os.Setenv("DATACENTER_URL", tt.envURL)
-		if err != nil {
-			return
-		}
-		defer func() {
-			err := os.Unsetenv("DATACENTER_URL")
-			if err != nil {
-				return
-			}
-		}()
-	} else {
-		err := os.Unsetenv("DATACENTER_URL")
-		if err != nil {
-			return
-		}
-	}
+	datacenters = &DatacenterSource{}
+
+	previous := cfg.DatacenterURLs
+	_ = setList(&cfg.DatacenterURLs)(tt.envURL)
+	defer func() {
+		cfg.DatacenterURLs = previous
+	}()
 
 	servers, errors := fetchServerStatus(context.Background())
 
@@ -318,7 +276,7 @@ func TestFetchAndParseDatacenter(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got, err := FetchAndParseDatacenter(tt.url)
+			got, err := FetchAndParseDatacenter(context.Background(), tt.url)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("FetchAndParseDatacenter() error = %v, wantErr %v", err, tt.wantErr)
 				return
@@ -363,7 +321,7 @@ func TestFetchAndParseStatus(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got, err := FetchAndParseStatus(tt.url)
+			got, err := FetchAndParseStatus(context.Background(), tt.url)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("FetchAndParseStatus() error = %v, wantErr %v", err, tt.wantErr)
 				return
@@ -378,3 +336,248 @@ func TestFetchAndParseStatus(t *testing.T) {
 		})
 	}
 }
+
+var twoWorldDcResponse = `
+    <ArrayOfDatacenterStruct>
+        <DatacenterStruct>
+            <KeyName>Test</KeyName>
+            <Datacenter>
+                <cachedAt>2024-01-01T00:00:00Z</cachedAt>
+                <datacenter>
+                    <Datacenter>
+                        <Worlds>
+                            <World>
+                                <Name>GoodWorld</Name>
+                                <StatusServerUrl>%s</StatusServerUrl>
+                                <Order>1</Order>
+                            </World>
+                            <World>
+                                <Name>BadWorld</Name>
+                                <StatusServerUrl>%s</StatusServerUrl>
+                                <Order>2</Order>
+                            </World>
+                        </Worlds>
+                    </Datacenter>
+                </datacenter>
+            </Datacenter>
+        </DatacenterStruct>
+    </ArrayOfDatacenterStruct>`
+
+func TestFetchServerStatusReportsFailedWorlds(t *testing.T) {
+	statusServer := newXMLTestServer(statusResponse)
+	defer statusServer.Close()
+
+	datacenterServer := newXMLTestServer(fmt.Sprintf(twoWorldDcResponse, statusServer.URL, invalidUrl))
+	defer datacenterServer.Close()
+
+	cleanup := setupEnv(t, datacenterServer.URL)
+	defer cleanup()
+
+	servers, errors := fetchServerStatus(context.Background())
+
+	if len(servers) != 2 {
+		t.Fatalf("fetchServerStatus() servers = %v, want 2", len(servers))
+	}
+	if len(errors) != 1 {
+		t.Errorf("fetchServerStatus() errors = %v, want 1", len(errors))
+	}
+
+	if servers[0].Name != "GoodWorld" || servers[0].State != types.StateOnline {
+		t.Errorf("servers[0] = %+v, want GoodWorld online", servers[0])
+	}
+
+	bad := servers[1]
+	if bad.Name != "BadWorld" || bad.State != types.StateError {
+		t.Errorf("servers[1] = %+v, want BadWorld in error state", bad)
+	}
+	if bad.Status {
+		t.Error("failed world reported as up")
+	}
+	if bad.Error == "" {
+		t.Error("failed world has no error reference")
+	}
+}
+
+func TestBuildServerInfo(t *testing.T) {
+	world := types.World{Name: "Argonnessen", StatusServerUrl: "http://argo.test/status", Order: 3}
+
+	lastKnown.Set(world.StatusServerUrl, knownStatus{CommonName: "Argonnessen", Status: true})
+
+	tests := []struct {
+		name          string
+		result        types.WorkerResult
+		ok            bool
+		wantState     types.ServerState
+		wantLastKnown bool
+	}{
+		{
+			name:      "successful fetch",
+			result:    types.WorkerResult{URL: world.StatusServerUrl, Status: &types.Status{Name: "Argonnessen"}},
+			ok:        true,
+			wantState: types.StateOffline,
+		},
+		{
+			name:          "failed fetch",
+			result:        types.WorkerResult{URL: world.StatusServerUrl, Error: fmt.Errorf("boom")},
+			ok:            true,
+			wantState:     types.StateError,
+			wantLastKnown: true,
+		},
+		{
+			name:          "no result",
+			ok:            false,
+			wantState:     types.StateUnknown,
+			wantLastKnown: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := buildServerInfo(world, tt.result, tt.ok)
+
+			if got.State != tt.wantState {
+				t.Errorf("buildServerInfo() state = %v, want %v", got.State, tt.wantState)
+			}
+			if (got.LastKnownStatus != nil) != tt.wantLastKnown {
+				t.Errorf("buildServerInfo() lastKnownStatus = %v, want present %v", got.LastKnownStatus, tt.wantLastKnown)
+			}
+			if got.Order != world.Order {
+				t.Errorf("buildServerInfo() order = %v, want %v", got.Order, world.Order)
+			}
+		})
+	}
+}
+
+func TestHandleRequestVersions(t *testing.T) {
+	statusServer := newXMLTestServer(statusResponse)
+	defer statusServer.Close()
+
+	datacenterServer := newXMLTestServer(fmt.Sprintf(dcResponse, statusServer.URL))
+	defer datacenterServer.Close()
+
+	cleanup := setupEnv(t, datacenterServer.URL)
+	defer cleanup()
+
+	t.Run("v2 schema", func(t *testing.T) {
+		got, err := handleRequest(context.Background(), events.APIGatewayProxyRequest{
+			Path:    "/v2/server_status",
+			Headers: map[string]string{"Origin": "https://ddocompendium.com"},
+		})
+		if err != nil {
+			t.Fatalf("handleRequest() error = %v", err)
+		}
+
+		var response types.ResponseV2
+		if err := json.Unmarshal([]byte(got.Body), &response); err != nil {
+			t.Fatalf("Failed to unmarshal response: %v", err)
+		}
+
+		if len(response.Servers) != 1 || response.Servers[0].State != types.StateOnline {
+			t.Errorf("servers = %+v, want one online server", response.Servers)
+		}
+		if response.GeneratedAt.IsZero() {
+			t.Error("generatedAt not set")
+		}
+		if got.Headers["Access-Control-Allow-Origin"] != "https://ddocompendium.com" {
+			t.Errorf("CORS origin = %q, want ddocompendium.com", got.Headers["Access-Control-Allow-Origin"])
+		}
+	})
+
+	t.Run("unknown version", func(t *testing.T) {
+		got, err := handleRequest(context.Background(), events.APIGatewayProxyRequest{Path: "/v9/server_status"})
+		if err != nil {
+			t.Fatalf("handleRequest() error = %v", err)
+		}
+
+		if got.StatusCode != http.StatusNotFound {
+			t.Errorf("status = %v, want %v", got.StatusCode, http.StatusNotFound)
+		}
+	})
+}
+
+// failingBody is a response body whose Read and Close return the configured errors.
+type failingBody struct {
+	io.Reader
+	readErr  error
+	closeErr error
+}
+
+func (b *failingBody) Read(p []byte) (int, error) {
+	if b.readErr != nil {
+		return 0, b.readErr
+	}
+	return b.Reader.Read(p)
+}
+
+func (b *failingBody) Close() error {
+	return b.closeErr
+}
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// useUpstreamTransport routes upstream fetches through rt for the rest of the test.
+func useUpstreamTransport(t *testing.T, rt http.RoundTripper) {
+	previous := upstreamClient
+	upstreamClient = &http.Client{Transport: rt}
+	t.Cleanup(func() {
+		upstreamClient = previous
+	})
+}
+
+func TestFetchWithFailingBodyClose(t *testing.T) {
+	errClose := errors.New("close failed")
+	errRead := errors.New("read failed")
+	datacenterBody := fmt.Sprintf(dcResponse, "http://world.example")
+
+	fetchers := map[string]struct {
+		body  string
+		fetch func(context.Context, string) (any, error)
+	}{
+		"datacenter": {body: datacenterBody, fetch: func(ctx context.Context, url string) (any, error) {
+			return FetchAndParseDatacenter(ctx, url)
+		}},
+		"status": {body: statusResponse, fetch: func(ctx context.Context, url string) (any, error) {
+			return FetchAndParseStatus(ctx, url)
+		}},
+	}
+
+	tests := []struct {
+		name         string
+		readErr      error
+		wantErr      bool
+		wantCloseErr bool
+	}{
+		{name: "close error after successful read is logged", readErr: nil, wantErr: false, wantCloseErr: false},
+		{name: "close error is joined into read error", readErr: errRead, wantErr: true, wantCloseErr: true},
+	}
+
+	for fetcherName, fetcher := range fetchers {
+		for _, tt := range tests {
+			t.Run(fetcherName+"/"+tt.name, func(t *testing.T) {
+				useUpstreamTransport(t, roundTripFunc(func(req *http.Request) (*http.Response, error) {
+					return &http.Response{
+						StatusCode: http.StatusOK,
+						Header:     http.Header{contentTypeKey: []string{contentTypeValue}},
+						Body:       &failingBody{Reader: strings.NewReader(fetcher.body), readErr: tt.readErr, closeErr: errClose},
+						Request:    req,
+					}, nil
+				}))
+
+				got, err := fetcher.fetch(context.Background(), "http://upstream.example")
+				if (err != nil) != tt.wantErr {
+					t.Fatalf("fetch error = %v, wantErr %v", err, tt.wantErr)
+				}
+				if errors.Is(err, errClose) != tt.wantCloseErr {
+					t.Errorf("errors.Is(err, errClose) = %v, want %v", errors.Is(err, errClose), tt.wantCloseErr)
+				}
+				if !tt.wantErr && reflect.ValueOf(got).IsNil() {
+					t.Error("fetch returned nil result without an error")
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/veteran-software/yourddo-api/shared/types"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	metricsPath        = "/metrics"
+	metricsContentType = "text/plain; version=0.0.4; charset=utf-8"
+)
+
+// Fetch error phases reported by the ddo_fetch_errors_total counter
+const (
+	phaseConfig          = "config"
+	phaseDatacenterFetch = "datacenter_fetch"
+	phaseDatacenterParse = "datacenter_parse"
+	phaseWorldFetch      = "world_fetch"
+	phaseWorldParse      = "world_parse"
+)
+
+// parseError marks an error caused by an upstream document that was fetched but could not be parsed.
+type parseError struct {
+	err error
+}
+
+func (e *parseError) Error() string {
+	return e.err.Error()
+}
+
+func (e *parseError) Unwrap() error {
+	return e.err
+}
+
+type worldMetrics struct {
+	up           bool
+	queueDepth   int64
+	fetchSeconds float64
+	lastSuccess  time.Time
+}
+
+// Metrics holds the values exposed at /metrics for the lifetime of a warm container or standalone server.
+type Metrics struct {
+	mu          sync.Mutex
+	worlds      map[string]*worldMetrics
+	fetchErrors map[string]uint64
+	hedges      uint64
+	hedgeWins   uint64
+}
+
+func NewMetrics() *Metrics {
+	return &Metrics{
+		worlds:      make(map[string]*worldMetrics),
+		fetchErrors: make(map[string]uint64),
+	}
+}
+
+var metrics = NewMetrics()
+
+// ObserveWorld records the outcome of polling a single world.
+func (m *Metrics) ObserveWorld(server *types.ServerInfo) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	world, ok := m.worlds[server.Name]
+	if !ok {
+		world = &worldMetrics{}
+		m.worlds[server.Name] = world
+	}
+
+	world.up = server.State == types.StateOnline
+	world.fetchSeconds = server.FetchDuration.Seconds()
+	world.queueDepth = 0
+
+	if server.Queue != nil {
+		world.queueDepth = server.Queue.Depth
+	}
+
+	if server.State == types.StateOnline || server.State == types.StateOffline {
+		world.lastSuccess = server.CheckedAt
+	}
+}
+
+// RetainWorlds drops the series of every world not named in names, such as worlds that were hidden or removed from
+// the datacenter.
+func (m *Metrics) RetainWorlds(names []string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	keep := make(map[string]bool, len(names))
+	for _, name := range names {
+		keep[name] = true
+	}
+
+	for name := range m.worlds {
+		if !keep[name] {
+			delete(m.worlds, name)
+		}
+	}
+}
+
+// IncFetchError counts an upstream error in the given phase.
+func (m *Metrics) IncFetchError(phase string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.fetchErrors[phase]++
+}
+
+// IncHedge counts a hedged second request.
+func (m *Metrics) IncHedge() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.hedges++
+}
+
+// IncHedgeWin counts a hedged request that answered before the original one.
+func (m *Metrics) IncHedgeWin() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.hedgeWins++
+}
+
+// WritePrometheus writes every metric in the Prometheus text exposition format.
+func (m *Metrics) WritePrometheus(w io.Writer) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	names := make([]string, 0, len(m.worlds))
+	for name := range m.worlds {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	bw := bufio.NewWriter(w)
+
+	gauge := func(name, help string, value func(*worldMetrics) (float64, bool)) {
+		_, _ = fmt.Fprintf(bw, "# HELP %s %s\n# TYPE %s gauge\n", name, help, name)
+		for _, world := range names {
+			if v, ok := value(m.worlds[world]); ok {
+				_, _ = fmt.Fprintf(bw, "%s{world=\"%s\"} %g\n", name, escapeLabelValue(world), v)
+			}
+		}
+	}
+
+	gauge("ddo_world_up", "Whether the world is accepting players (1) or not (0).", func(wm *worldMetrics) (float64, bool) {
+		if wm.up {
+			return 1, true
+		}
+		return 0, true
+	})
+	gauge("ddo_world_queue_depth", "Players waiting in the world's login queue.", func(wm *worldMetrics) (float64, bool) {
+		return float64(wm.queueDepth), true
+	})
+	gauge("ddo_world_fetch_duration_seconds", "Duration of the last status fetch for the world.", func(wm *worldMetrics) (float64, bool) {
+		return wm.fetchSeconds, true
+	})
+	gauge("ddo_world_last_success_timestamp_seconds", "Unix time of the last successful status fetch for the world.", func(wm *worldMetrics) (float64, bool) {
+		if wm.lastSuccess.IsZero() {
+			return 0, false
+		}
+		return float64(wm.lastSuccess.Unix()), true
+	})
+
+	phases := make([]string, 0, len(m.fetchErrors))
+	for phase := range m.fetchErrors {
+		phases = append(phases, phase)
+	}
+	sort.Strings(phases)
+
+	_, _ = fmt.Fprint(bw, "# HELP ddo_fetch_errors_total Upstream fetch errors by phase.\n# TYPE ddo_fetch_errors_total counter\n")
+	for _, phase := range phases {
+		_, _ = fmt.Fprintf(bw, "ddo_fetch_errors_total{phase=\"%s\"} %d\n", escapeLabelValue(phase), m.fetchErrors[phase])
+	}
+
+	_, _ = fmt.Fprintf(bw, "# HELP ddo_hedged_requests_total World status fetches that were hedged with a second request.\n# TYPE ddo_hedged_requests_total counter\nddo_hedged_requests_total %d\n", m.hedges)
+	_, _ = fmt.Fprintf(bw, "# HELP ddo_hedge_wins_total Hedged requests that answered before the original request.\n# TYPE ddo_hedge_wins_total counter\nddo_hedge_wins_total %d\n", m.hedgeWins)
+
+	return bw.Flush()
+}
+
+// escapeLabelValue escapes a label value as required by the text exposition format.
+func escapeLabelValue(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+}
+
+// errorPhase classifies a snapshot error into the phase it occurred in.
+func errorPhase(err error) string {
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		return phaseWorldFetch
+	}
+
+	var parseErr *parseError
+	parsed := errors.As(err, &parseErr)
+
+	switch apiErr.Code {
+	case CodeConfigMissing:
+		return phaseConfig
+	case CodeDatacenterUnavailable, CodeDatacenterTimeout, CodeDatacenterTooLarge:
+		if parsed {
+			return phaseDatacenterParse
+		}
+		return phaseDatacenterFetch
+	default:
+		if parsed {
+			return phaseWorldParse
+		}
+		return phaseWorldFetch
+	}
+}
+
+// serveMetrics polls the worlds and responds with the current metrics in Prometheus text format.
+func serveMetrics(ctx context.Context) events.APIGatewayProxyResponse {
+	fetchSnapshot(ctx)
+
+	var body strings.Builder
+	if err := metrics.WritePrometheus(&body); err != nil {
+		return internalServerError()
+	}
+
+	return events.APIGatewayProxyResponse{
+		StatusCode: http.StatusOK,
+		Headers: map[string]string{
+			"Content-Type":  metricsContentType,
+			"Cache-Control": "no-store",
+		},
+		Body: body.String(),
+	}
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/veteran-software/yourddo-api/shared/types"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMetricsWritePrometheus(t *testing.T) {
+	m := NewMetrics()
+	checkedAt := time.Unix(1704110400, 0)
+
+	m.ObserveWorld(&types.ServerInfo{
+		Name:          "Argonnessen",
+		State:         types.StateOnline,
+		Queue:         &types.QueueInfo{Depth: 12},
+		CheckedAt:     checkedAt,
+		FetchDuration: 250 * time.Millisecond,
+	})
+	m.ObserveWorld(&types.ServerInfo{Name: `Odd "World"`, State: types.StateError, CheckedAt: checkedAt, FetchDuration: time.Second})
+	m.IncFetchError(phaseWorldFetch)
+	m.IncFetchError(phaseWorldFetch)
+
+	var out strings.Builder
+	if err := m.WritePrometheus(&out); err != nil {
+		t.Fatalf("WritePrometheus() error = %v", err)
+	}
+
+	for _, want := range []string{
+		"# TYPE ddo_world_up gauge",
+		`ddo_world_up{world="Argonnessen"} 1`,
+		`ddo_world_up{world="Odd \"World\""} 0`,
+		`ddo_world_queue_depth{world="Argonnessen"} 12`,
+		`ddo_world_fetch_duration_seconds{world="Argonnessen"} 0.25`,
+		`ddo_world_last_success_timestamp_seconds{world="Argonnessen"} 1.7041104e+09`,
+		"# TYPE ddo_fetch_errors_total counter",
+		`ddo_fetch_errors_total{phase="world_fetch"} 2`,
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("exposition is missing %q:\n%s", want, out.String())
+		}
+	}
+
+	if strings.Contains(out.String(), `ddo_world_last_success_timestamp_seconds{world="Odd`) {
+		t.Error("world that never succeeded has a last success timestamp")
+	}
+}
+
+func TestMetricsRetainWorlds(t *testing.T) {
+	m := NewMetrics()
+	for _, name := range []string{"Argonnessen", "Cannith", "Lamannia"} {
+		m.ObserveWorld(&types.ServerInfo{Name: name, State: types.StateOnline})
+	}
+
+	m.RetainWorlds([]string{"Argonnessen", "Cannith"})
+
+	var out strings.Builder
+	if err := m.WritePrometheus(&out); err != nil {
+		t.Fatalf("WritePrometheus() error = %v", err)
+	}
+
+	if strings.Contains(out.String(), "Lamannia") {
+		t.Errorf("exposition still has the dropped world:\n%s", out.String())
+	}
+	if !strings.Contains(out.String(), `ddo_world_up{world="Cannith"} 1`) {
+		t.Errorf("exposition is missing a retained world:\n%s", out.String())
+	}
+}
+
+func TestErrorPhase(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want string
+	}{
+		{name: "config", err: &APIError{Code: CodeConfigMissing, Err: errDatacenterURLNotSet}, want: phaseConfig},
+		{name: "datacenter fetch", err: &APIError{Code: CodeDatacenterUnavailable, Err: errors.New("refused")}, want: phaseDatacenterFetch},
+		{
+			name: "datacenter parse",
+			err:  &APIError{Code: CodeDatacenterUnavailable, Err: &parseError{err: errors.New("bad xml")}},
+			want: phaseDatacenterParse,
+		},
+		{name: "world fetch", err: &APIError{Code: CodeWorldUnavailable, Err: errors.New("timeout")}, want: phaseWorldFetch},
+		{
+			name: "world parse",
+			err:  &APIError{Code: CodeWorldUnavailable, Err: &parseError{err: errors.New("bad xml")}},
+			want: phaseWorldParse,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := errorPhase(tt.err); got != tt.want {
+				t.Errorf("errorPhase() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHandleRequestMetrics(t *testing.T) {
+	cleanup := setupEnv(t, "")
+	defer cleanup()
+
+	got, err := handleRequest(context.Background(), events.APIGatewayProxyRequest{Path: "/metrics"})
+	if err != nil {
+		t.Fatalf("handleRequest() error = %v", err)
+	}
+
+	if got.StatusCode != http.StatusOK {
+		t.Errorf("status = %v, want %v", got.StatusCode, http.StatusOK)
+	}
+	if got.Headers["Content-Type"] != metricsContentType {
+		t.Errorf("Content-Type = %q", got.Headers["Content-Type"])
+	}
+	if !strings.Contains(got.Body, `ddo_fetch_errors_total{phase="config"}`) {
+		t.Errorf("missing configuration error counter:\n%s", got.Body)
+	}
+}
@@ -0,0 +1,331 @@
+package main
+
+import (
+	"encoding/json"
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/veteran-software/yourddo-api/shared/types"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	openAPIPath = "/openapi.json"
+	// badgeRoute is the OpenAPI template of the paths matched by badgePath.
+	badgeRoute = "/server_status/{world}/badge.svg"
+)
+
+// Schema is the subset of an OpenAPI 3.0 schema object produced by schemaFor.
+type Schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Enum                 []string           `json:"enum,omitempty"`
+	Nullable             bool               `json:"nullable,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	AdditionalProperties *bool              `json:"additionalProperties,omitempty"`
+}
+
+var (
+	timeType        = reflect.TypeOf(time.Time{})
+	serverStateType = reflect.TypeOf(types.ServerState(""))
+
+	// enumValues lists the allowed values of string types that act as enums.
+	enumValues = map[reflect.Type][]string{
+		serverStateType: {
+			string(types.StateOnline),
+			string(types.StateOffline),
+			string(types.StateUnknown),
+			string(types.StateError),
+		},
+	}
+)
+
+// schemaRegistry collects the named component schemas referenced while walking the response types.
+type schemaRegistry struct {
+	schemas map[string]*Schema
+}
+
+// schemaFor returns the schema of t, registering struct types as components and referencing them by name.
+func (r *schemaRegistry) schemaFor(t reflect.Type) *Schema {
+	if values, ok := enumValues[t]; ok {
+		return &Schema{Type: "string", Enum: values}
+	}
+
+	switch t.Kind() {
+	case reflect.Pointer:
+		return r.schemaFor(t.Elem())
+	case reflect.Slice:
+		return &Schema{Type: "array", Items: r.schemaFor(t.Elem()), Nullable: true}
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int32:
+		return &Schema{Type: "integer", Format: "int32"}
+	case reflect.Int64:
+		return &Schema{Type: "integer", Format: "int64"}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: "number", Format: "double"}
+	case reflect.Struct:
+		if t == timeType {
+			return &Schema{Type: "string", Format: "date-time"}
+		}
+
+		if _, ok := r.schemas[t.Name()]; !ok {
+			r.schemas[t.Name()] = nil // reserve the name before recursing
+			r.schemas[t.Name()] = r.structSchema(t)
+		}
+
+		return &Schema{Ref: "#/components/schemas/" + t.Name()}
+	default:
+		return &Schema{}
+	}
+}
+
+func (r *schemaRegistry) structSchema(t reflect.Type) *Schema {
+	closed := false
+	schema := &Schema{
+		Type:                 "object",
+		Properties:           make(map[string]*Schema),
+		AdditionalProperties: &closed,
+	}
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+
+		name, opts, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		schema.Properties[name] = r.schemaFor(field.Type)
+		if !strings.Contains(opts, "omitempty") {
+			schema.Required = append(schema.Required, name)
+		}
+	}
+
+	return schema
+}
+
+// jsonOperation describes a GET endpoint returning the given schema as JSON.
+func jsonOperation(summary string, schema *Schema) map[string]any {
+	return map[string]any{
+		"get": map[string]any{
+			"summary": summary,
+			"responses": map[string]any{
+				"200": map[string]any{
+					"description": "OK",
+					"content": map[string]any{
+						"application/json": map[string]any{"schema": schema},
+					},
+				},
+				"304": map[string]any{
+					"description": "Not Modified; the If-None-Match or If-Modified-Since precondition matched",
+				},
+			},
+		},
+	}
+}
+
+// statusOperation describes a server status endpoint, which also supports the non-JSON formats of negotiateFormat.
+func statusOperation(summary string, schema *Schema) map[string]any {
+	op := jsonOperation(summary, schema)
+	get := op["get"].(map[string]any)
+	responses := get["responses"].(map[string]any)
+
+	content := responses["200"].(map[string]any)["content"].(map[string]any)
+	content["application/xml"] = map[string]any{"schema": &Schema{Type: "string"}}
+	content["text/csv"] = map[string]any{"schema": &Schema{Type: "string"}}
+	content["text/plain"] = map[string]any{"schema": &Schema{Type: "string"}}
+
+	responses["406"] = map[string]any{"description": "None of the accepted formats can be produced"}
+	get["parameters"] = []map[string]any{
+		{
+			"name":        "format",
+			"in":          "query",
+			"description": "Output format, overriding the Accept header",
+			"schema":      &Schema{Type: "string", Enum: []string{"json", "xml", "csv", "text", "txt"}},
+		},
+	}
+
+	return op
+}
+
+// withAPIKey marks op as accepting an optional API key and documents the responses of rejected and throttled requests.
+func withAPIKey(op map[string]any) map[string]any {
+	get := op["get"].(map[string]any)
+	get["security"] = []map[string]any{{}, {"apiKeyHeader": []string{}}, {"apiKeyQuery": []string{}}}
+
+	responses := get["responses"].(map[string]any)
+	responses["401"] = map[string]any{"description": "The API key is missing or invalid"}
+	responses["403"] = map[string]any{"description": "The API key may not be used from this origin"}
+	responses["429"] = map[string]any{"description": "The client is over its rate limit or its API key's daily quota; see Retry-After"}
+
+	return op
+}
+
+// feedOperation describes a change feed endpoint served with the given media type.
+func feedOperation(summary, mediaType string) map[string]any {
+	return map[string]any{
+		"get": map[string]any{
+			"summary": summary,
+			"responses": map[string]any{
+				"200": map[string]any{
+					"description": "OK",
+					"content": map[string]any{
+						mediaType: map[string]any{"schema": &Schema{Type: "string"}},
+					},
+				},
+			},
+		},
+	}
+}
+
+// badgeOperation describes the per-world SVG badge endpoint.
+func badgeOperation() map[string]any {
+	return map[string]any{
+		"get": map[string]any{
+			"summary": "Status badge of a single world",
+			"parameters": []map[string]any{
+				{"name": "world", "in": "path", "required": true, "schema": &Schema{Type: "string"}},
+				{"name": "label", "in": "query", "description": "Replaces the world name", "schema": &Schema{Type: "string"}},
+				{
+					"name":   "style",
+					"in":     "query",
+					"schema": &Schema{Type: "string", Enum: []string{string(badgeFlat), string(badgeFlatSquare), string(badgeForTheBadge)}},
+				},
+			},
+			"responses": map[string]any{
+				"200": map[string]any{
+					"description": "OK",
+					"content": map[string]any{
+						"image/svg+xml": map[string]any{"schema": &Schema{Type: "string"}},
+					},
+				},
+				"304": map[string]any{"description": "Not Modified"},
+				"400": map[string]any{"description": "Unknown style"},
+				"404": map[string]any{"description": "Unknown world"},
+			},
+		},
+	}
+}
+
+// metricsOperation describes the Prometheus metrics endpoint.
+func metricsOperation() map[string]any {
+	return map[string]any{
+		"get": map[string]any{
+			"summary": "Prometheus metrics of world status and upstream fetches",
+			"responses": map[string]any{
+				"200": map[string]any{
+					"description": "OK",
+					"content": map[string]any{
+						"text/plain": map[string]any{"schema": &Schema{Type: "string"}},
+					},
+				},
+				"429": map[string]any{"description": "The client is over its rate limit; see Retry-After"},
+			},
+		},
+	}
+}
+
+// healthOperation describes the health endpoint, which reports failures through its status code.
+func healthOperation(schema *Schema) map[string]any {
+	content := map[string]any{
+		"application/json": map[string]any{"schema": schema},
+	}
+
+	return map[string]any{
+		"get": map[string]any{
+			"summary": "Health of the API's dependencies and reachability of the game's servers",
+			"responses": map[string]any{
+				"200": map[string]any{"description": "Healthy", "content": content},
+				"500": map[string]any{"description": "The API keys cannot be loaded or Redis does not answer", "content": content},
+				"503": map[string]any{"description": "The game's servers cannot be reached", "content": content},
+				"429": map[string]any{"description": "The client is over its rate limit; see Retry-After"},
+			},
+		},
+	}
+}
+
+// buildOpenAPISpec generates the OpenAPI 3 document for the API from the response types in shared/types.
+func buildOpenAPISpec() map[string]any {
+	registry := &schemaRegistry{schemas: make(map[string]*Schema)}
+
+	v1 := registry.schemaFor(reflect.TypeOf(types.Response{}))
+	v2 := registry.schemaFor(reflect.TypeOf(types.ResponseV2{}))
+	health := registry.schemaFor(reflect.TypeOf(types.HealthResponse{}))
+
+	return map[string]any{
+		"openapi": "3.0.3",
+		"info": map[string]any{
+			"title":   "YourDDO Server Status API",
+			"version": "2",
+		},
+		"paths": map[string]any{
+			"/server_status":           withAPIKey(statusOperation("World status (v1 schema, kept for existing clients)", v1)),
+			"/v1/server_status":        withAPIKey(statusOperation("World status (v1 schema)", v1)),
+			"/v2/server_status":        withAPIKey(statusOperation("World status (v2 schema)", v2)),
+			"/server_status/feed.atom": withAPIKey(feedOperation("World status transitions as an Atom feed", "application/atom+xml")),
+			"/server_status/feed.rss":  withAPIKey(feedOperation("World status transitions as an RSS 2.0 feed", "application/rss+xml")),
+			badgeRoute:                 withAPIKey(badgeOperation()),
+			healthPath:                 healthOperation(health),
+			metricsPath:                metricsOperation(),
+			openAPIPath:                jsonOperation("This document", &Schema{Type: "object"}),
+		},
+		"components": map[string]any{
+			"schemas": registry.schemas,
+			"securitySchemes": map[string]any{
+				"apiKeyHeader": map[string]any{"type": "apiKey", "in": "header", "name": apiKeyHeader},
+				"apiKeyQuery":  map[string]any{"type": "apiKey", "in": "query", "name": apiKeyQueryParam},
+			},
+		},
+	}
+}
+
+var (
+	openAPIOnce sync.Once
+	openAPIJSON []byte
+	openAPIErr  error
+)
+
+// openAPIDocument returns the generated OpenAPI document, building it on first use.
+func openAPIDocument() ([]byte, error) {
+	openAPIOnce.Do(func() {
+		openAPIJSON, openAPIErr = json.Marshal(buildOpenAPISpec())
+	})
+
+	return openAPIJSON, openAPIErr
+}
+
+// isOpenAPIPath reports whether the request path asks for the OpenAPI document.
+func isOpenAPIPath(path string) bool {
+	return stripVersion(path) == openAPIPath
+}
+
+// serveOpenAPI responds with the generated OpenAPI document.
+func serveOpenAPI(req events.APIGatewayProxyRequest) events.APIGatewayProxyResponse {
+	doc, err := openAPIDocument()
+	if err != nil {
+		return internalServerError()
+	}
+
+	headers := map[string]string{"Content-Type": "application/json"}
+	applyCORS(req, headers)
+
+	return events.APIGatewayProxyResponse{
+		StatusCode: http.StatusOK,
+		Headers:    headers,
+		Body:       string(doc),
+	}
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/aws/aws-lambda-go/events"
+	"math"
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// validateSchema checks a decoded JSON value against a generated schema, resolving component references.
+func validateSchema(path string, value any, schema *Schema, components map[string]*Schema) error {
+	if schema.Ref != "" {
+		return validateSchema(path, value, components[strings.TrimPrefix(schema.Ref, "#/components/schemas/")], components)
+	}
+
+	if value == nil {
+		if schema.Nullable {
+			return nil
+		}
+		return fmt.Errorf("%s: null is not allowed", path)
+	}
+
+	switch schema.Type {
+	case "object":
+		obj, ok := value.(map[string]any)
+		if !ok {
+			return fmt.Errorf("%s: want object, got %T", path, value)
+		}
+		for _, name := range schema.Required {
+			if _, ok := obj[name]; !ok {
+				return fmt.Errorf("%s: missing required property %q", path, name)
+			}
+		}
+		for name, v := range obj {
+			prop, ok := schema.Properties[name]
+			if !ok {
+				if schema.AdditionalProperties != nil && !*schema.AdditionalProperties {
+					return fmt.Errorf("%s: property %q is not in the spec", path, name)
+				}
+				continue
+			}
+			if err := validateSchema(path+"."+name, v, prop, components); err != nil {
+				return err
+			}
+		}
+	case "array":
+		arr, ok := value.([]any)
+		if !ok {
+			return fmt.Errorf("%s: want array, got %T", path, value)
+		}
+		for i, v := range arr {
+			if err := validateSchema(fmt.Sprintf("%s[%d]", path, i), v, schema.Items, components); err != nil {
+				return err
+			}
+		}
+	case "string":
+		s, ok := value.(string)
+		if !ok {
+			return fmt.Errorf("%s: want string, got %T", path, value)
+		}
+		if len(schema.Enum) > 0 && !slices.Contains(schema.Enum, s) {
+			return fmt.Errorf("%s: %q is not one of %v", path, s, schema.Enum)
+		}
+		if schema.Format == "date-time" {
+			if _, err := time.Parse(time.RFC3339, s); err != nil {
+				return fmt.Errorf("%s: %q is not a date-time", path, s)
+			}
+		}
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			return fmt.Errorf("%s: want boolean, got %T", path, value)
+		}
+	case "integer":
+		n, ok := value.(float64)
+		if !ok || n != math.Trunc(n) {
+			return fmt.Errorf("%s: want integer, got %v", path, value)
+		}
+	case "number":
+		if _, ok := value.(float64); !ok {
+			return fmt.Errorf("%s: want number, got %T", path, value)
+		}
+	}
+
+	return nil
+}
+
+// responseSchema returns the 200 response schema the spec declares for a path.
+func responseSchema(t *testing.T, spec map[string]any, path string) *Schema {
+	t.Helper()
+
+	op, ok := spec["paths"].(map[string]any)[path].(map[string]any)
+	if !ok {
+		t.Fatalf("spec has no path %q", path)
+	}
+
+	get := op["get"].(map[string]any)
+	ok200 := get["responses"].(map[string]any)["200"].(map[string]any)
+	content := ok200["content"].(map[string]any)["application/json"].(map[string]any)
+
+	return content["schema"].(*Schema)
+}
+
+func TestHandlerOutputMatchesOpenAPISpec(t *testing.T) {
+	statusServer := newXMLTestServer(statusResponse)
+	defer statusServer.Close()
+
+	datacenterServer := newXMLTestServer(fmt.Sprintf(twoWorldDcResponse, statusServer.URL, invalidUrl))
+	defer datacenterServer.Close()
+
+	spec := buildOpenAPISpec()
+	components := spec["components"].(map[string]any)["schemas"].(map[string]*Schema)
+
+	tests := []struct {
+		name   string
+		envURL string
+		path   string
+	}{
+		{name: "v1 with failed world", envURL: datacenterServer.URL, path: "/v1/server_status"},
+		{name: "v2 with failed world", envURL: datacenterServer.URL, path: "/v2/server_status"},
+		{name: "v1 without configuration", envURL: "", path: "/v1/server_status"},
+		{name: "v2 without configuration", envURL: "", path: "/v2/server_status"},
+		{name: "unversioned", envURL: datacenterServer.URL, path: "/server_status"},
+		{name: "health", envURL: datacenterServer.URL, path: healthPath},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cleanup := setupEnv(t, tt.envURL)
+			defer cleanup()
+
+			got, err := handleRequest(context.Background(), events.APIGatewayProxyRequest{Path: tt.path})
+			if err != nil {
+				t.Fatalf("handleRequest() error = %v", err)
+			}
+
+			var body any
+			if err := json.Unmarshal([]byte(got.Body), &body); err != nil {
+				t.Fatalf("Failed to unmarshal response: %v", err)
+			}
+
+			if err := validateSchema("$", body, responseSchema(t, spec, tt.path), components); err != nil {
+				t.Errorf("response drifted from the OpenAPI spec: %v", err)
+			}
+		})
+	}
+}
+
+func TestHandleRequestServesOpenAPI(t *testing.T) {
+	got, err := handleRequest(context.Background(), events.APIGatewayProxyRequest{Path: openAPIPath})
+	if err != nil {
+		t.Fatalf("handleRequest() error = %v", err)
+	}
+
+	if got.StatusCode != http.StatusOK {
+		t.Fatalf("status = %v, want %v", got.StatusCode, http.StatusOK)
+	}
+
+	var doc map[string]any
+	if err := json.Unmarshal([]byte(got.Body), &doc); err != nil {
+		t.Fatalf("Failed to unmarshal OpenAPI document: %v", err)
+	}
+
+	if doc["openapi"] != "3.0.3" {
+		t.Errorf("openapi = %v, want 3.0.3", doc["openapi"])
+	}
+
+	schemas := doc["components"].(map[string]any)["schemas"].(map[string]any)
+	for _, name := range []string{"Response", "ServerInfo", "ResponseV2", "ServerInfoV2", "QueueInfo", "ErrorInfo"} {
+		if _, ok := schemas[name]; !ok {
+			t.Errorf("components.schemas is missing %s", name)
+		}
+	}
+}
+
+func TestOpenAPISpecCoversRoutes(t *testing.T) {
+	paths := buildOpenAPISpec()["paths"].(map[string]any)
+
+	for _, path := range []string{"/server_status", "/v2/server_status", "/server_status/feed.atom", badgeRoute, healthPath, metricsPath, openAPIPath} {
+		if _, ok := paths[path]; !ok {
+			t.Errorf("spec has no path %q", path)
+		}
+	}
+
+	if _, ok := badgeWorldFromPath(strings.Replace(badgeRoute, "{world}", "Thelanis", 1)); !ok {
+		t.Errorf("badge route %q does not match badgePath", badgeRoute)
+	}
+}
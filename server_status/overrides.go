@@ -0,0 +1,96 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/veteran-software/yourddo-api/shared/types"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// WorldOverride changes how one world is presented. Unset fields leave the values read from the datacenter alone.
+type WorldOverride struct {
+	DisplayName string `json:"displayName"`
+	// Hidden drops the world from every response; hidden worlds are not polled either.
+	Hidden bool     `json:"hidden"`
+	Tags   []string `json:"tags"`
+	// Order pins the world's position, replacing the order from the datacenter.
+	Order *int              `json:"order"`
+	Links []types.WorldLink `json:"links"`
+}
+
+// loadWorldOverrides reads a JSON object mapping world names to WorldOverride, keyed by lowercased world name. Returns
+// nil when path is empty.
+func loadWorldOverrides(path string) (map[string]WorldOverride, error) {
+	if path == "" {
+		return nil, nil
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading WORLD_OVERRIDES_PATH: %w", err)
+	}
+
+	var decoded map[string]WorldOverride
+	if err := json.Unmarshal(content, &decoded); err != nil {
+		return nil, fmt.Errorf("error decoding world overrides from %s: %w", path, err)
+	}
+
+	worlds := make(map[string]WorldOverride, len(decoded))
+	for name, override := range decoded {
+		if err := override.validate(); err != nil {
+			return nil, fmt.Errorf("error loading world overrides from %s: world %q: %w", path, name, err)
+		}
+
+		worlds[strings.ToLower(strings.TrimSpace(name))] = override
+	}
+
+	return worlds, nil
+}
+
+func (w WorldOverride) validate() error {
+	for _, link := range w.Links {
+		if link.Title == "" {
+			return fmt.Errorf("link %q has no title", link.URL)
+		}
+
+		parsed, err := url.Parse(link.URL)
+		if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+			return fmt.Errorf("link %q must be an http or https URL", link.URL)
+		}
+	}
+
+	return nil
+}
+
+// lookupOverride returns the override of the world named name.
+func lookupOverride(worlds map[string]WorldOverride, name string) (WorldOverride, bool) {
+	override, ok := worlds[strings.ToLower(strings.TrimSpace(name))]
+	return override, ok
+}
+
+// apply merges the override into info.
+func (w WorldOverride) apply(info *types.ServerInfo) {
+	if w.DisplayName != "" {
+		info.DisplayName = w.DisplayName
+	}
+	if w.Order != nil {
+		info.Order = *w.Order
+	}
+	if len(w.Tags) > 0 {
+		info.Tags = w.Tags
+	}
+	if len(w.Links) > 0 {
+		info.Links = w.Links
+	}
+}
+
+// displayName is the name shown to people for a world: its display name when one is overridden, otherwise its name.
+func displayName(server *types.ServerInfo) string {
+	if server.DisplayName != "" {
+		return server.DisplayName
+	}
+
+	return server.Name
+}
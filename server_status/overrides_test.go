@@ -0,0 +1,210 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/veteran-software/yourddo-api/shared/types"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// useOverrides loads the overrides file content into the configuration for the rest of the test.
+func useOverrides(t *testing.T, content string) {
+	worlds, err := loadWorldOverrides(writeConfigFile(t, "overrides.json", content))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	useConfig(t, func(c *Config) {
+		c.WorldOverrides = worlds
+	})
+}
+
+func TestLoadWorldOverrides(t *testing.T) {
+	pinned := 1
+
+	tests := []struct {
+		name    string
+		content string
+		want    map[string]WorldOverride
+		wantErr bool
+	}{
+		{
+			name: "keyed by lowercased name",
+			content: `{
+				"Argonnessen": {"displayName": "Argonnessen (64-bit)", "tags": ["64-bit"], "order": 1},
+				" Lamannia ": {"hidden": true},
+				"Thelanis": {"links": [{"title": "Forum", "url": "https://forums.ddo.com/thelanis"}]}
+			}`,
+			want: map[string]WorldOverride{
+				"argonnessen": {DisplayName: "Argonnessen (64-bit)", Tags: []string{"64-bit"}, Order: &pinned},
+				"lamannia":    {Hidden: true},
+				"thelanis":    {Links: []types.WorldLink{{Title: "Forum", URL: "https://forums.ddo.com/thelanis"}}},
+			},
+		},
+		{name: "malformed", content: `{"Thelanis": `, wantErr: true},
+		{name: "not an object", content: `["Argonnessen"]`, wantErr: true},
+		{name: "link without a title", content: `{"Thelanis": {"links": [{"url": "https://ddo.com"}]}}`, wantErr: true},
+		{name: "link to another scheme", content: `{"Thelanis": {"links": [{"title": "Run", "url": "javascript:alert(1)"}]}}`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := loadWorldOverrides(writeConfigFile(t, "overrides.json", tt.content))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("loadWorldOverrides() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("loadWorldOverrides() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadWorldOverridesDisabled(t *testing.T) {
+	got, err := loadWorldOverrides("")
+	if got != nil || err != nil {
+		t.Errorf("loadWorldOverrides() = %v, %v, want nil and no error", got, err)
+	}
+}
+
+func TestLoadConfigWorldOverrides(t *testing.T) {
+	env := map[string]string{"DATACENTER_URL": "https://ddo.com/datacenter"}
+
+	env["WORLD_OVERRIDES_PATH"] = writeConfigFile(t, "overrides.json", `{"Lamannia": {"hidden": true}}`)
+	got, err := LoadConfig(context.Background(), lookupMap(env))
+	if err != nil {
+		t.Fatalf("LoadConfig() error = %v", err)
+	}
+	if !got.WorldOverrides["lamannia"].Hidden {
+		t.Errorf("WorldOverrides = %+v, want Lamannia hidden", got.WorldOverrides)
+	}
+
+	// A broken file must stop the cold start rather than expose the worlds it hides
+	for name, path := range map[string]string{
+		"malformed": writeConfigFile(t, "broken.json", `{"Lamannia": `),
+		"missing":   filepath.Join(t.TempDir(), "missing.json"),
+	} {
+		t.Run(name, func(t *testing.T) {
+			env["WORLD_OVERRIDES_PATH"] = path
+			if _, err := LoadConfig(context.Background(), lookupMap(env)); err == nil {
+				t.Error("LoadConfig() succeeded")
+			}
+		})
+	}
+}
+
+func TestWorldOverrideApply(t *testing.T) {
+	pinned := 0
+	info := &types.ServerInfo{Name: "Cannith", CommonName: "Cannith", Order: 4, Tags: []string{"kept"}}
+
+	WorldOverride{DisplayName: "Cannith (Hardcore)", Order: &pinned}.apply(info)
+
+	want := &types.ServerInfo{Name: "Cannith", CommonName: "Cannith", DisplayName: "Cannith (Hardcore)", Order: 0, Tags: []string{"kept"}}
+	if !reflect.DeepEqual(info, want) {
+		t.Errorf("apply() = %+v, want %+v", info, want)
+	}
+}
+
+func TestFetchServerStatusAppliesOverrides(t *testing.T) {
+	var hiddenRequests atomic.Int32
+	hidden := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hiddenRequests.Add(1)
+		w.Header().Set(contentTypeKey, contentTypeValue)
+		_, _ = w.Write([]byte(statusResponse))
+	}))
+	defer hidden.Close()
+
+	visible := newXMLTestServer(statusResponse)
+	defer visible.Close()
+
+	datacenterServer := newXMLTestServer(fmt.Sprintf(`
+		<ArrayOfDatacenterStruct>
+			<DatacenterStruct>
+				<KeyName>Test</KeyName>
+				<Datacenter>
+					<datacenter>
+						<Datacenter>
+							<Worlds>
+								<World><Name>Argonnessen</Name><StatusServerUrl>%[1]s</StatusServerUrl><Order>1</Order></World>
+								<World><Name>Cannith</Name><StatusServerUrl>%[1]s</StatusServerUrl><Order>2</Order></World>
+								<World><Name>Lamannia</Name><StatusServerUrl>%[2]s</StatusServerUrl><Order>3</Order></World>
+							</Worlds>
+						</Datacenter>
+					</datacenter>
+				</Datacenter>
+			</DatacenterStruct>
+		</ArrayOfDatacenterStruct>`, visible.URL, hidden.URL))
+	defer datacenterServer.Close()
+
+	useOverrides(t, `{
+		"cannith": {"displayName": "Cannith (Hardcore)", "tags": ["Hardcore League"], "order": 0,
+			"links": [{"title": "League rules", "url": "https://www.ddo.com/hardcore"}]},
+		"Lamannia": {"hidden": true}
+	}`)
+
+	cleanup := setupEnv(t, datacenterServer.URL)
+	defer cleanup()
+
+	previous := metrics
+	metrics = NewMetrics()
+	t.Cleanup(func() {
+		metrics = previous
+	})
+
+	// Lamannia was polled before it was hidden
+	metrics.ObserveWorld(&types.ServerInfo{Name: "Lamannia", State: types.StateOnline})
+
+	servers, errs := fetchServerStatus(context.Background())
+	if len(errs) != 0 {
+		t.Fatalf("fetchServerStatus() errors = %v", errs)
+	}
+
+	if hiddenRequests.Load() != 0 {
+		t.Errorf("hidden world was polled %d times", hiddenRequests.Load())
+	}
+	if len(servers) != 2 || servers[0].Name != "Cannith" || servers[1].Name != "Argonnessen" {
+		t.Fatalf("servers = %+v, want Cannith pinned before Argonnessen and Lamannia hidden", servers)
+	}
+
+	var exposition strings.Builder
+	if err := metrics.WritePrometheus(&exposition); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(exposition.String(), "Lamannia") {
+		t.Errorf("metrics still report the hidden world:\n%s", exposition.String())
+	}
+
+	body, err := json.Marshal(toServerInfoV2(servers[0]))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got map[string]any
+	if err := json.Unmarshal(body, &got); err != nil {
+		t.Fatal(err)
+	}
+	if got["displayName"] != "Cannith (Hardcore)" || got["order"] != float64(0) ||
+		!reflect.DeepEqual(got["tags"], []any{"Hardcore League"}) ||
+		!reflect.DeepEqual(got["links"], []any{map[string]any{"title": "League rules", "url": "https://www.ddo.com/hardcore"}}) {
+		t.Errorf("v2 world = %s", body)
+	}
+
+	v1, err := json.Marshal(servers[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	var v1Fields map[string]any
+	if err := json.Unmarshal(v1, &v1Fields); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := v1Fields["displayName"]; ok {
+		t.Errorf("v1 world = %s, want the v1 schema unchanged", v1)
+	}
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"github.com/veteran-software/yourddo-api/shared/types"
+	"strconv"
+	"strings"
+)
+
+// parseQueueInfo extracts the login queue from a status document. Queue numbers are reported as hexadecimal strings
+// (e.g. "0x0001B2F0"); values that cannot be parsed are treated as zero.
+func parseQueueInfo(status *types.Status) *types.QueueInfo {
+	nowServing := parseQueueNumber(status.NowServingQueueNumber)
+	lastAssigned := parseQueueNumber(status.LastAssignedQueueNumber)
+
+	depth := lastAssigned - nowServing
+	if depth < 0 {
+		depth = 0
+	}
+
+	waitHint, err := strconv.ParseFloat(strings.TrimSpace(status.WaitHint), 64)
+	if err != nil {
+		waitHint = 0
+	}
+
+	full, err := strconv.ParseBool(strings.TrimSpace(status.WorldFull))
+	if err != nil {
+		full = false
+	}
+
+	return &types.QueueInfo{
+		NowServing:   nowServing,
+		LastAssigned: lastAssigned,
+		Depth:        depth,
+		WaitHint:     waitHint,
+		Full:         full,
+	}
+}
+
+func parseQueueNumber(value string) int64 {
+	n, err := strconv.ParseInt(strings.TrimSpace(value), 0, 64)
+	if err != nil {
+		return 0
+	}
+
+	return n
+}
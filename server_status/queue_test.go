@@ -0,0 +1,49 @@
+package main
+
+import (
+	"github.com/veteran-software/yourddo-api/shared/types"
+	"reflect"
+	"testing"
+)
+
+func TestParseQueueInfo(t *testing.T) {
+	tests := []struct {
+		name   string
+		status *types.Status
+		want   *types.QueueInfo
+	}{
+		{
+			name: "hex queue numbers",
+			status: &types.Status{
+				NowServingQueueNumber:   "0x00000010",
+				LastAssignedQueueNumber: "0x00000018",
+				WaitHint:                "2.50",
+				WorldFull:               "true",
+			},
+			want: &types.QueueInfo{NowServing: 16, LastAssigned: 24, Depth: 8, WaitHint: 2.5, Full: true},
+		},
+		{
+			name:   "empty status",
+			status: &types.Status{},
+			want:   &types.QueueInfo{},
+		},
+		{
+			name: "now serving ahead of last assigned",
+			status: &types.Status{
+				NowServingQueueNumber:   "20",
+				LastAssignedQueueNumber: "10",
+				WorldFull:               "garbage",
+			},
+			want: &types.QueueInfo{NowServing: 20, LastAssigned: 10},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := parseQueueInfo(tt.status)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseQueueInfo() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/redis/go-redis/v9"
+	"sync"
+	"time"
+)
+
+// QuotaStore counts the requests of each API key during a UTC day. Take counts one request against id unless limit,
+// when positive, is already used up, and returns the requests used so far that day.
+type QuotaStore interface {
+	Take(ctx context.Context, id string, limit int64, now time.Time) (used int64, ok bool, err error)
+}
+
+// quotaDay returns the start of the UTC day of now.
+func quotaDay(now time.Time) time.Time {
+	return now.UTC().Truncate(24 * time.Hour)
+}
+
+// MemoryQuotaStore counts in the memory of one container. Behind Lambda every container keeps its own counts, so a
+// key can make up to its quota in each of them.
+type MemoryQuotaStore struct {
+	mu   sync.Mutex
+	day  time.Time
+	used map[string]int64
+}
+
+func NewMemoryQuotaStore() *MemoryQuotaStore {
+	return &MemoryQuotaStore{}
+}
+
+func (s *MemoryQuotaStore) Take(_ context.Context, id string, limit int64, now time.Time) (int64, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if day := quotaDay(now); !day.Equal(s.day) || s.used == nil {
+		s.day = day
+		s.used = make(map[string]int64)
+	}
+
+	if limit > 0 && s.used[id] >= limit {
+		return s.used[id], false, nil
+	}
+
+	s.used[id]++
+	return s.used[id], true, nil
+}
+
+// takeQuotaScript counts a request in a daily counter that expires after its day, and takes it back when the limit
+// is exceeded, so rejected requests are not counted.
+var takeQuotaScript = redis.NewScript(`
+local limit = tonumber(ARGV[1])
+local used = redis.call('INCR', KEYS[1])
+if used == 1 then
+	redis.call('EXPIREAT', KEYS[1], ARGV[2])
+end
+if limit > 0 and used > limit then
+	return {redis.call('DECR', KEYS[1]), 0}
+end
+return {used, 1}
+`)
+
+// RedisQuotaStore counts in Redis, so every container of a deployment shares the counts.
+type RedisQuotaStore struct {
+	client *redis.Client
+}
+
+func NewRedisQuotaStore(client *redis.Client) *RedisQuotaStore {
+	return &RedisQuotaStore{client: client}
+}
+
+func (s *RedisQuotaStore) Take(ctx context.Context, id string, limit int64, now time.Time) (int64, bool, error) {
+	day := quotaDay(now)
+	key := "quota:" + id + ":" + day.Format(time.DateOnly)
+
+	// Counters outlive their day by an hour, so a container with a slightly slow clock still finds the right one
+	expireAt := day.Add(25 * time.Hour).Unix()
+
+	reply, err := takeQuotaScript.Run(ctx, s.client, []string{key}, limit, expireAt).Int64Slice()
+	if err != nil {
+		return 0, false, fmt.Errorf("error counting quota: %w", err)
+	}
+	if len(reply) != 2 {
+		return 0, false, fmt.Errorf("unexpected quota reply %v", reply)
+	}
+
+	return reply[0], reply[1] == 1, nil
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// testQuotaStore runs the same day of requests through store.
+func testQuotaStore(t *testing.T, store QuotaStore) {
+	day := time.Date(2024, 1, 1, 23, 59, 0, 0, time.UTC)
+
+	steps := []struct {
+		id     string
+		limit  int64
+		at     time.Time
+		want   int64
+		wantOK bool
+	}{
+		{id: "a", limit: 2, at: day, want: 1, wantOK: true},
+		{id: "a", limit: 2, at: day, want: 2, wantOK: true},
+		{id: "a", limit: 2, at: day, want: 2, wantOK: false},
+		{id: "b", limit: 2, at: day, want: 1, wantOK: true},
+		{id: "a", limit: 2, at: day.Add(time.Minute), want: 1, wantOK: true},
+		{id: "c", limit: 0, at: day, want: 1, wantOK: true},
+	}
+
+	for i, step := range steps {
+		used, ok, err := store.Take(context.Background(), step.id, step.limit, step.at)
+		if err != nil {
+			t.Fatalf("step %d: Take() error = %v", i, err)
+		}
+		if used != step.want || ok != step.wantOK {
+			t.Errorf("step %d: Take(%s) = %d, %v, want %d, %v", i, step.id, used, ok, step.want, step.wantOK)
+		}
+	}
+}
+
+func TestMemoryQuotaStore(t *testing.T) {
+	testQuotaStore(t, NewMemoryQuotaStore())
+}
+
+func TestRedisQuotaStore(t *testing.T) {
+	server, client := newTestRedis(t)
+
+	testQuotaStore(t, NewRedisQuotaStore(client))
+
+	if got, err := server.Get("quota:a:2024-01-01"); err != nil || got != "2" {
+		t.Errorf("quota:a:2024-01-01 = %q, %v, want 2", got, err)
+	}
+	if got, err := server.Get("quota:a:2024-01-02"); err != nil || got != "1" {
+		t.Errorf("quota:a:2024-01-02 = %q, %v, want 1", got, err)
+	}
+	// miniredis reports EXPIREAT deadlines relative to its own clock, set to noon on 2024-01-01
+	if ttl := server.TTL("quota:a:2024-01-01"); ttl != 13*time.Hour {
+		t.Errorf("quota:a:2024-01-01 TTL = %v, want it to expire an hour after its day", ttl)
+	}
+}
+
+func TestQuotasSharedAcrossContainers(t *testing.T) {
+	_, client := newTestRedis(t)
+
+	// Two authenticators stand in for two Lambda containers sharing one Redis server
+	first := authenticatorFromConfig(AuthConfig{}, client)
+	second := authenticatorFromConfig(AuthConfig{}, client)
+
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	if _, ok, _ := first.quotas.Take(context.Background(), "limited", 1, now); !ok {
+		t.Fatal("first request rejected")
+	}
+	if _, ok, _ := second.quotas.Take(context.Background(), "limited", 1, now); ok {
+		t.Error("second container accepted a request over the shared quota")
+	}
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/redis/go-redis/v9"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	defaultRateLimitBurst = 10
+	// maxBuckets bounds the memory store; past it, the least recently used bucket is dropped.
+	maxBuckets = 10_000
+)
+
+// RateLimit is a token bucket: it holds up to Burst tokens, refills PerMinute tokens a minute, and every request takes
+// one token.
+type RateLimit struct {
+	PerMinute int
+	Burst     int
+}
+
+// perMillisecond returns the refill rate in tokens per millisecond.
+func (l RateLimit) perMillisecond() float64 {
+	return float64(l.PerMinute) / float64(time.Minute.Milliseconds())
+}
+
+// refill returns the tokens in a bucket that held tokens elapsed ago.
+func (l RateLimit) refill(tokens float64, elapsed time.Duration) float64 {
+	return math.Min(float64(l.Burst), tokens+float64(elapsed.Milliseconds())*l.perMillisecond())
+}
+
+// RateDecision is the outcome of taking a token.
+type RateDecision struct {
+	Allowed   bool
+	Remaining int
+	// RetryAfter is the time until the next token, when the request was not allowed.
+	RetryAfter time.Duration
+	// Reset is the time until the bucket is full again.
+	Reset time.Duration
+}
+
+// decide builds the decision for a bucket left with tokens after a request.
+func (l RateLimit) decide(tokens float64, allowed bool) RateDecision {
+	rate := l.perMillisecond()
+	decision := RateDecision{
+		Allowed:   allowed,
+		Remaining: int(tokens),
+		Reset:     time.Duration(math.Ceil((float64(l.Burst)-tokens)/rate)) * time.Millisecond,
+	}
+
+	if !allowed {
+		decision.RetryAfter = time.Duration(math.Ceil((1-tokens)/rate)) * time.Millisecond
+	}
+
+	return decision
+}
+
+// RateLimitStore keeps token buckets. Take removes one token from the bucket named key if it has one.
+type RateLimitStore interface {
+	Take(ctx context.Context, key string, limit RateLimit) (RateDecision, error)
+}
+
+type tokenBucket struct {
+	key     string
+	tokens  float64
+	updated time.Time
+}
+
+// MemoryRateLimitStore keeps buckets in the memory of one container, which suits a single long-running instance.
+// Behind Lambda every container has its own buckets, so the effective limit grows with concurrency. At most maxBuckets
+// are kept; a client whose bucket was dropped starts again with a full one.
+type MemoryRateLimitStore struct {
+	mu      sync.Mutex
+	buckets map[string]*list.Element
+	// recent orders the buckets from most to least recently used
+	recent *list.List
+	now    func() time.Time
+}
+
+func NewMemoryRateLimitStore() *MemoryRateLimitStore {
+	return &MemoryRateLimitStore{buckets: make(map[string]*list.Element), recent: list.New(), now: time.Now}
+}
+
+func (s *MemoryRateLimitStore) Take(_ context.Context, key string, limit RateLimit) (RateDecision, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+
+	element, ok := s.buckets[key]
+	if ok {
+		s.recent.MoveToFront(element)
+	} else {
+		if len(s.buckets) >= maxBuckets {
+			oldest := s.recent.Back()
+			s.recent.Remove(oldest)
+			delete(s.buckets, oldest.Value.(*tokenBucket).key)
+		}
+
+		element = s.recent.PushFront(&tokenBucket{key: key, tokens: float64(limit.Burst), updated: now})
+		s.buckets[key] = element
+	}
+
+	bucket := element.Value.(*tokenBucket)
+	bucket.tokens = limit.refill(bucket.tokens, now.Sub(bucket.updated))
+	bucket.updated = now
+
+	allowed := bucket.tokens >= 1
+	if allowed {
+		bucket.tokens--
+	}
+
+	return limit.decide(bucket.tokens, allowed), nil
+}
+
+// RateLimiter throttles each client: requests with an API key share the key's bucket, others share the bucket of
+// their source IP.
+type RateLimiter struct {
+	store RateLimitStore
+	limit RateLimit
+}
+
+func NewRateLimiter(store RateLimitStore, limit RateLimit) *RateLimiter {
+	return &RateLimiter{store: store, limit: limit}
+}
+
+// rateLimiterFromConfig builds the limiter for the rate limit configuration. Rate limiting is off unless PerMinute is
+// set, and buckets are kept in memory unless client, the shared Redis server, is set.
+func rateLimiterFromConfig(c RateLimitConfig, client *redis.Client) *RateLimiter {
+	if c.PerMinute < 1 {
+		return NewRateLimiter(nil, RateLimit{})
+	}
+
+	limit := RateLimit{PerMinute: c.PerMinute, Burst: max(c.Burst, 1)}
+
+	var store RateLimitStore = NewMemoryRateLimitStore()
+	if client != nil {
+		store = NewRedisRateLimitStore(client)
+	}
+
+	return NewRateLimiter(store, limit)
+}
+
+var limiter *RateLimiter
+
+// Enabled reports whether requests are rate limited.
+func (l *RateLimiter) Enabled() bool {
+	return l.store != nil
+}
+
+// clientKey names the bucket of the client making req, or returns "" when the client cannot be identified.
+func clientKey(req events.APIGatewayProxyRequest, granted *authorization) string {
+	if granted.key != nil {
+		return "key:" + granted.key.ID
+	}
+
+	if ip := req.RequestContext.Identity.SourceIP; ip != "" {
+		return "ip:" + ip
+	}
+
+	return ""
+}
+
+// allow takes a token for the client making req, adding the rate limit headers to granted and returning the response
+// to send instead when the client is over its limit. Errors from the store let the request through.
+func (l *RateLimiter) allow(ctx context.Context, req events.APIGatewayProxyRequest, granted *authorization) *events.APIGatewayProxyResponse {
+	if !l.Enabled() {
+		return nil
+	}
+
+	key := clientKey(req, granted)
+	if key == "" {
+		return nil
+	}
+
+	decision, err := l.store.Take(ctx, key, l.limit)
+	if err != nil {
+		loggerFromContext(ctx).Warn("rate limit check failed, allowing request", "error", err)
+		return nil
+	}
+
+	granted.headers["X-RateLimit-Limit"] = strconv.Itoa(l.limit.PerMinute)
+	granted.headers["X-RateLimit-Remaining"] = strconv.Itoa(decision.Remaining)
+	granted.headers["X-RateLimit-Reset"] = strconv.Itoa(ceilSeconds(decision.Reset))
+	exposeHeaders(granted.headers, "X-RateLimit-Limit", "X-RateLimit-Remaining", "X-RateLimit-Reset")
+
+	if decision.Allowed {
+		return nil
+	}
+
+	granted.headers["Retry-After"] = strconv.Itoa(max(ceilSeconds(decision.RetryAfter), 1))
+	exposeHeaders(granted.headers, "Retry-After")
+	loggerFromContext(ctx).Info("request rate limited", "client", key)
+
+	return authError(req, http.StatusTooManyRequests, fmt.Sprintf("Too Many Requests: limit of %d requests per minute exceeded", l.limit.PerMinute), granted.headers)
+}
+
+// serveLimited calls serve when the client making req is within its rate limit. It guards the endpoints that never
+// require an API key, so clients are told apart by source IP only.
+func serveLimited(ctx context.Context, req events.APIGatewayProxyRequest, serve func(context.Context) events.APIGatewayProxyResponse) events.APIGatewayProxyResponse {
+	granted := &authorization{headers: map[string]string{}}
+	if denied := limiter.allow(ctx, req, granted); denied != nil {
+		return *denied
+	}
+
+	return withHeaders(serve(ctx), granted.headers)
+}
+
+// ceilSeconds rounds d up to whole seconds.
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
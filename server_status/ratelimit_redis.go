@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/redis/go-redis/v9"
+	"strconv"
+)
+
+// takeTokenScript refills and takes from a bucket stored as a hash of its tokens and last update in milliseconds. It
+// reads the clock of the Redis server, so every container agrees on the time. Tokens are returned as a string, since
+// Redis truncates Lua numbers to integers.
+var takeTokenScript = redis.NewScript(`
+local rate = tonumber(ARGV[1])
+local burst = tonumber(ARGV[2])
+local time = redis.call('TIME')
+local now = tonumber(time[1]) * 1000 + math.floor(tonumber(time[2]) / 1000)
+local bucket = redis.call('HMGET', KEYS[1], 'tokens', 'updated')
+local tokens = tonumber(bucket[1]) or burst
+local updated = tonumber(bucket[2]) or now
+tokens = math.min(burst, tokens + math.max(0, now - updated) * rate)
+local allowed = 0
+if tokens >= 1 then
+	tokens = tokens - 1
+	allowed = 1
+end
+redis.call('HSET', KEYS[1], 'tokens', tostring(tokens), 'updated', tostring(now))
+redis.call('PEXPIRE', KEYS[1], math.ceil((burst - tokens) / rate) + 1000)
+return {allowed, tostring(tokens)}
+`)
+
+// RedisRateLimitStore keeps buckets in Redis, so every container of a deployment shares them.
+type RedisRateLimitStore struct {
+	client *redis.Client
+}
+
+func NewRedisRateLimitStore(client *redis.Client) *RedisRateLimitStore {
+	return &RedisRateLimitStore{client: client}
+}
+
+func (s *RedisRateLimitStore) Take(ctx context.Context, key string, limit RateLimit) (RateDecision, error) {
+	reply, err := takeTokenScript.Run(ctx, s.client, []string{"ratelimit:" + key},
+		strconv.FormatFloat(limit.perMillisecond(), 'g', -1, 64), limit.Burst).Slice()
+	if err != nil {
+		return RateDecision{}, fmt.Errorf("error taking a rate limit token: %w", err)
+	}
+
+	if len(reply) != 2 {
+		return RateDecision{}, fmt.Errorf("unexpected rate limit reply %v", reply)
+	}
+
+	allowed, _ := reply[0].(int64)
+	text, _ := reply[1].(string)
+	tokens, err := strconv.ParseFloat(text, 64)
+	if err != nil {
+		return RateDecision{}, fmt.Errorf("unexpected rate limit tokens %q: %w", text, err)
+	}
+
+	return limit.decide(tokens, allowed == 1), nil
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestRedisRateLimitStoreTake(t *testing.T) {
+	server, client := newTestRedis(t)
+	store := NewRedisRateLimitStore(client)
+
+	limit := RateLimit{PerMinute: 60, Burst: 2}
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	steps := []struct {
+		name string
+		at   time.Duration
+		want RateDecision
+	}{
+		{name: "first request", want: RateDecision{Allowed: true, Remaining: 1, Reset: time.Second}},
+		{name: "burst used up", want: RateDecision{Allowed: true, Remaining: 0, Reset: 2 * time.Second}},
+		{name: "over the limit", want: RateDecision{RetryAfter: time.Second, Reset: 2 * time.Second}},
+		{name: "partly refilled", at: 500 * time.Millisecond, want: RateDecision{RetryAfter: 500 * time.Millisecond, Reset: 1500 * time.Millisecond}},
+		{name: "refilled one token", at: time.Second, want: RateDecision{Allowed: true, Remaining: 0, Reset: 2 * time.Second}},
+	}
+
+	for _, step := range steps {
+		t.Run(step.name, func(t *testing.T) {
+			server.SetTime(start.Add(step.at))
+
+			got, err := store.Take(context.Background(), "ip:203.0.113.1", limit)
+			if err != nil {
+				t.Fatalf("Take() error = %v", err)
+			}
+			if got != step.want {
+				t.Errorf("Take() = %+v, want %+v", got, step.want)
+			}
+		})
+	}
+
+	if !server.Exists("ratelimit:ip:203.0.113.1") {
+		t.Error("bucket not stored under ratelimit:ip:203.0.113.1")
+	}
+	if ttl := server.TTL("ratelimit:ip:203.0.113.1"); ttl <= 0 || ttl > 3*time.Second {
+		t.Errorf("bucket TTL = %v, want it to expire once refilled", ttl)
+	}
+}
+
+func TestRedisRateLimitStoreUnavailable(t *testing.T) {
+	server, client := newTestRedis(t)
+	store := NewRedisRateLimitStore(client)
+
+	server.Close()
+
+	if _, err := store.Take(context.Background(), "ip:203.0.113.1", RateLimit{PerMinute: 60, Burst: 1}); err == nil {
+		t.Fatal("Take() succeeded without a Redis server")
+	}
+}
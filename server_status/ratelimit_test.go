@@ -0,0 +1,257 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/redis/go-redis/v9"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// useRateLimiter replaces limiter for the rest of the test.
+func useRateLimiter(t *testing.T, l *RateLimiter) {
+	previous := limiter
+	limiter = l
+	t.Cleanup(func() {
+		limiter = previous
+	})
+}
+
+type failingRateLimitStore struct{}
+
+func (failingRateLimitStore) Take(context.Context, string, RateLimit) (RateDecision, error) {
+	return RateDecision{}, errors.New("store unavailable")
+}
+
+func TestMemoryRateLimitStore(t *testing.T) {
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	now := start
+
+	store := NewMemoryRateLimitStore()
+	store.now = func() time.Time { return now }
+
+	limit := RateLimit{PerMinute: 60, Burst: 2}
+
+	steps := []struct {
+		name           string
+		at             time.Duration
+		key            string
+		wantAllowed    bool
+		wantRemaining  int
+		wantRetryAfter time.Duration
+		wantReset      time.Duration
+	}{
+		{name: "first request", key: "a", wantAllowed: true, wantRemaining: 1, wantReset: time.Second},
+		{name: "burst used up", key: "a", wantAllowed: true, wantRemaining: 0, wantReset: 2 * time.Second},
+		{name: "over the limit", key: "a", wantAllowed: false, wantRemaining: 0, wantRetryAfter: time.Second, wantReset: 2 * time.Second},
+		{name: "other client", key: "b", wantAllowed: true, wantRemaining: 1, wantReset: time.Second},
+		{name: "partly refilled", at: 500 * time.Millisecond, key: "a", wantAllowed: false, wantRetryAfter: 500 * time.Millisecond, wantReset: 1500 * time.Millisecond},
+		{name: "refilled one token", at: time.Second, key: "a", wantAllowed: true, wantRemaining: 0, wantReset: 2 * time.Second},
+		{name: "refill stops at burst", at: time.Hour, key: "a", wantAllowed: true, wantRemaining: 1, wantReset: time.Second},
+	}
+
+	for _, step := range steps {
+		t.Run(step.name, func(t *testing.T) {
+			now = start.Add(step.at)
+
+			got, err := store.Take(context.Background(), step.key, limit)
+			if err != nil {
+				t.Fatalf("Take() error = %v", err)
+			}
+
+			want := RateDecision{Allowed: step.wantAllowed, Remaining: step.wantRemaining, RetryAfter: step.wantRetryAfter, Reset: step.wantReset}
+			if got != want {
+				t.Errorf("Take() = %+v, want %+v", got, want)
+			}
+		})
+	}
+}
+
+func TestMemoryRateLimitStoreDropsLeastRecentlyUsed(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	store := NewMemoryRateLimitStore()
+	store.now = func() time.Time { return now }
+
+	limit := RateLimit{PerMinute: 1, Burst: 1}
+	for i := range maxBuckets {
+		_, _ = store.Take(context.Background(), "ip:"+strconv.Itoa(i), limit)
+	}
+
+	// ip:0 is used again, so ip:1 becomes the least recently used; no bucket has refilled
+	_, _ = store.Take(context.Background(), "ip:0", limit)
+	_, _ = store.Take(context.Background(), "ip:new", limit)
+
+	if got := len(store.buckets); got != maxBuckets {
+		t.Errorf("len(buckets) = %d, want the cap of %d", got, maxBuckets)
+	}
+	if _, ok := store.buckets["ip:1"]; ok {
+		t.Error("least recently used bucket was kept")
+	}
+	if got, _ := store.Take(context.Background(), "ip:0", limit); got.Allowed {
+		t.Error("recently used bucket was dropped and refilled")
+	}
+}
+
+func TestRateLimitedRequests(t *testing.T) {
+	useAuthenticator(t, NewAuthenticator(testKeyStore(t), false))
+	useRateLimiter(t, NewRateLimiter(NewMemoryRateLimitStore(), RateLimit{PerMinute: 60, Burst: 1}))
+
+	request := func(ip, key string) events.APIGatewayProxyRequest {
+		req := events.APIGatewayProxyRequest{Path: "/server_status/feed.atom", Headers: map[string]string{}}
+		req.RequestContext.Identity.SourceIP = ip
+		if key != "" {
+			req.Headers["X-API-Key"] = key
+		}
+		return req
+	}
+
+	steps := []struct {
+		name          string
+		req           events.APIGatewayProxyRequest
+		wantStatus    int
+		wantRemaining string
+	}{
+		{name: "first request from an IP", req: request("203.0.113.1", ""), wantStatus: http.StatusOK, wantRemaining: "0"},
+		{name: "second request from the IP", req: request("203.0.113.1", ""), wantStatus: http.StatusTooManyRequests, wantRemaining: "0"},
+		{name: "another IP", req: request("203.0.113.2", ""), wantStatus: http.StatusOK, wantRemaining: "0"},
+		{name: "API key from a throttled IP", req: request("203.0.113.1", "free-key"), wantStatus: http.StatusOK, wantRemaining: "0"},
+		{name: "API key from another IP", req: request("203.0.113.3", "free-key"), wantStatus: http.StatusTooManyRequests, wantRemaining: "0"},
+		{name: "unidentified client", req: request("", ""), wantStatus: http.StatusOK},
+	}
+
+	for _, step := range steps {
+		t.Run(step.name, func(t *testing.T) {
+			got, err := handleRequest(context.Background(), step.req)
+			if err != nil {
+				t.Fatalf("handleRequest() error = %v", err)
+			}
+
+			if got.StatusCode != step.wantStatus {
+				t.Errorf("status = %v, want %v", got.StatusCode, step.wantStatus)
+			}
+			if got.Headers["X-RateLimit-Remaining"] != step.wantRemaining {
+				t.Errorf("X-RateLimit-Remaining = %q, want %q", got.Headers["X-RateLimit-Remaining"], step.wantRemaining)
+			}
+
+			if step.wantStatus == http.StatusTooManyRequests {
+				if got.Headers["Retry-After"] != "1" || got.Headers["X-RateLimit-Limit"] != "60" {
+					t.Errorf("Retry-After = %q, X-RateLimit-Limit = %q, want 1 and the per-minute rate 60", got.Headers["Retry-After"], got.Headers["X-RateLimit-Limit"])
+				}
+			}
+		})
+	}
+}
+
+func TestRateLimitedKeylessEndpoints(t *testing.T) {
+	useAuthenticator(t, NewAuthenticator(testKeyStore(t), true))
+
+	for _, path := range []string{healthPath, metricsPath} {
+		t.Run(path, func(t *testing.T) {
+			useRateLimiter(t, NewRateLimiter(NewMemoryRateLimitStore(), RateLimit{PerMinute: 60, Burst: 1}))
+
+			req := events.APIGatewayProxyRequest{Path: path}
+			req.RequestContext.Identity.SourceIP = "203.0.113.1"
+
+			first, err := handleRequest(context.Background(), req)
+			if err != nil {
+				t.Fatalf("handleRequest() error = %v", err)
+			}
+			if first.StatusCode == http.StatusUnauthorized || first.StatusCode == http.StatusTooManyRequests {
+				t.Fatalf("first request status = %v, want it served without a key", first.StatusCode)
+			}
+			if first.Headers["X-RateLimit-Remaining"] != "0" {
+				t.Errorf("X-RateLimit-Remaining = %q, want 0", first.Headers["X-RateLimit-Remaining"])
+			}
+
+			second, err := handleRequest(context.Background(), req)
+			if err != nil {
+				t.Fatalf("handleRequest() error = %v", err)
+			}
+			if second.StatusCode != http.StatusTooManyRequests {
+				t.Errorf("second request status = %v, want %v", second.StatusCode, http.StatusTooManyRequests)
+			}
+		})
+	}
+}
+
+func TestRateLimitedRequestsDoNotUseQuota(t *testing.T) {
+	useAuthenticator(t, NewAuthenticator(testKeyStore(t), false))
+	useRateLimiter(t, NewRateLimiter(NewMemoryRateLimitStore(), RateLimit{PerMinute: 1, Burst: 1}))
+
+	req := events.APIGatewayProxyRequest{Path: "/server_status/feed.atom", Headers: map[string]string{"X-API-Key": "limited-key"}}
+	for range 3 {
+		if _, err := handleRequest(context.Background(), req); err != nil {
+			t.Fatalf("handleRequest() error = %v", err)
+		}
+	}
+
+	// Only the first request got through the rate limit, so one of the key's two daily requests is left
+	useRateLimiter(t, NewRateLimiter(nil, RateLimit{}))
+
+	got, err := handleRequest(context.Background(), req)
+	if err != nil {
+		t.Fatalf("handleRequest() error = %v", err)
+	}
+
+	if got.StatusCode != http.StatusOK || got.Headers["X-Quota-Remaining"] != "0" {
+		t.Errorf("status = %v, X-Quota-Remaining = %q, want 200 and 0", got.StatusCode, got.Headers["X-Quota-Remaining"])
+	}
+}
+
+func TestRateLimiterAllowsRequestsWhenStoreFails(t *testing.T) {
+	useRateLimiter(t, NewRateLimiter(failingRateLimitStore{}, RateLimit{PerMinute: 1, Burst: 1}))
+
+	req := events.APIGatewayProxyRequest{Path: "/server_status/feed.atom"}
+	req.RequestContext.Identity.SourceIP = "203.0.113.1"
+
+	got, err := handleRequest(context.Background(), req)
+	if err != nil {
+		t.Fatalf("handleRequest() error = %v", err)
+	}
+
+	if got.StatusCode != http.StatusOK {
+		t.Errorf("status = %v, want %v", got.StatusCode, http.StatusOK)
+	}
+}
+
+func TestRateLimiterFromConfig(t *testing.T) {
+	client := redisClientFromConfig("redis://cache.internal:6379/1")
+
+	tests := []struct {
+		name      string
+		config    RateLimitConfig
+		client    *redis.Client
+		wantLimit RateLimit
+		wantRedis bool
+	}{
+		{name: "off by default", config: defaultConfig().RateLimit},
+		{name: "off by default with redis", config: defaultConfig().RateLimit, client: client},
+		{name: "burst", config: RateLimitConfig{PerMinute: 120, Burst: 30}, wantLimit: RateLimit{PerMinute: 120, Burst: 30}},
+		{
+			name:      "redis",
+			config:    RateLimitConfig{PerMinute: 60, Burst: defaultRateLimitBurst},
+			client:    client,
+			wantLimit: RateLimit{PerMinute: 60, Burst: defaultRateLimitBurst},
+			wantRedis: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := rateLimiterFromConfig(tt.config, tt.client)
+
+			if got.limit != tt.wantLimit {
+				t.Errorf("limit = %+v, want %+v", got.limit, tt.wantLimit)
+			}
+			if got.Enabled() != (tt.wantLimit.PerMinute > 0) {
+				t.Errorf("Enabled() = %v", got.Enabled())
+			}
+			if _, isRedis := got.store.(*RedisRateLimitStore); isRedis != tt.wantRedis {
+				t.Errorf("store = %T, want redis %v", got.store, tt.wantRedis)
+			}
+		})
+	}
+}
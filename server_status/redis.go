@@ -0,0 +1,45 @@
+package main
+
+import (
+	"fmt"
+	"github.com/redis/go-redis/v9"
+	"log/slog"
+	"time"
+)
+
+const redisTimeout = 500 * time.Millisecond
+
+// newRedisClient returns a client for a redis:// or rediss:// (TLS) URL such as redis://:password@host:6379/0. It
+// does not connect until the first command.
+func newRedisClient(raw string) (*redis.Client, error) {
+	options, err := redis.ParseURL(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid REDIS_URL: %w", err)
+	}
+
+	options.DialTimeout = redisTimeout
+	options.ReadTimeout = redisTimeout
+	options.WriteTimeout = redisTimeout
+
+	return redis.NewClient(options), nil
+}
+
+// redisClientFromConfig returns the client of the Redis server shared by every instance, or nil when none is set or
+// the URL is invalid, in which case state is kept per instance.
+func redisClientFromConfig(raw string) *redis.Client {
+	if raw == "" {
+		return nil
+	}
+
+	client, err := newRedisClient(raw)
+	if err != nil {
+		slog.Error("falling back to per-instance state", "error", err)
+		return nil
+	}
+
+	return client
+}
+
+// redisClient holds the rate limit buckets, quota counters, world transitions and last good datacenter document shared
+// by every container.
+var redisClient *redis.Client
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/veteran-software/yourddo-api/shared/types"
+	"regexp"
+	"time"
+)
+
+type apiVersion int
+
+const (
+	apiV1 apiVersion = 1
+	apiV2 apiVersion = 2
+)
+
+var versionPrefix = regexp.MustCompile(`^/v(\d+)(/|$)`)
+
+// snapshot is the result of a single poll of the datacenter and every world it lists.
+type snapshot struct {
+	Datacenter  types.DatacenterSummary
+	Servers     []*types.ServerInfo
+	Errors      []error
+	GeneratedAt time.Time
+}
+
+// apiVersionFromPath returns the API version requested by a path such as "/v2/server_status". Unversioned paths are
+// served by v1 so existing clients keep working. Returns false for versions that do not exist.
+func apiVersionFromPath(path string) (apiVersion, bool) {
+	match := versionPrefix.FindStringSubmatch(path)
+	if match == nil {
+		return apiV1, true
+	}
+
+	switch match[1] {
+	case "1":
+		return apiV1, true
+	case "2":
+		return apiV2, true
+	default:
+		return 0, false
+	}
+}
+
+// stripVersion removes a leading "/vN" segment from a path.
+func stripVersion(path string) string {
+	loc := versionPrefix.FindStringIndex(path)
+	if loc == nil {
+		return path
+	}
+
+	return "/" + path[loc[1]:]
+}
+
+// renderResponse encodes a snapshot in the negotiated format. JSON follows the requested API version's schema; the
+// other formats are flat renderings of the server list.
+func renderResponse(version apiVersion, format outputFormat, snap *snapshot) ([]byte, error) {
+	if format != formatJSON {
+		v1 := buildV1Response(snap)
+		return renderServers(format, v1.Servers, v1.Errors)
+	}
+
+	var response any
+	switch version {
+	case apiV2:
+		response = buildV2Response(snap)
+	default:
+		response = buildV1Response(snap)
+	}
+
+	body, err := json.Marshal(response)
+	if err != nil {
+		return nil, fmt.Errorf("error encoding JSON: %w", err)
+	}
+
+	return body, nil
+}
+
+// buildV1Response builds the original response schema. Its JSON must not change; see testdata/v1_response.golden.json.
+func buildV1Response(snap *snapshot) types.Response {
+	errorStrings := make([]string, 0, len(snap.Errors))
+	for _, err := range snap.Errors {
+		errorStrings = append(errorStrings, err.Error())
+	}
+
+	return types.Response{
+		Servers: snap.Servers,
+		Errors:  errorStrings,
+	}
+}
+
+// buildV2Response builds the v2 response schema from the same snapshot as v1.
+func buildV2Response(snap *snapshot) types.ResponseV2 {
+	servers := make([]*types.ServerInfoV2, 0, len(snap.Servers))
+	for _, server := range snap.Servers {
+		servers = append(servers, toServerInfoV2(server))
+	}
+
+	errorInfos := make([]types.ErrorInfo, 0, len(snap.Errors))
+	for _, err := range snap.Errors {
+		errorInfos = append(errorInfos, toErrorInfo(err))
+	}
+
+	return types.ResponseV2{
+		Datacenter:  snap.Datacenter,
+		Servers:     servers,
+		Errors:      errorInfos,
+		GeneratedAt: snap.GeneratedAt,
+	}
+}
+
+func toServerInfoV2(server *types.ServerInfo) *types.ServerInfoV2 {
+	info := &types.ServerInfoV2{
+		Name:        server.Name,
+		CommonName:  server.CommonName,
+		DisplayName: server.DisplayName,
+		State:       server.State,
+		Order:       server.Order,
+		Language:    server.Language,
+		Tags:        server.Tags,
+		Links:       server.Links,
+		Queue:       server.Queue,
+		CheckedAt:   server.CheckedAt,
+	}
+
+	if server.LastKnownStatus != nil && server.LastKnownAt != nil {
+		state := types.StateOffline
+		if *server.LastKnownStatus {
+			state = types.StateOnline
+		}
+
+		info.LastKnown = &types.LastKnownInfo{State: state, At: *server.LastKnownAt}
+	}
+
+	if server.Error != "" {
+		info.Error = &types.ErrorInfo{
+			Code:    server.ErrorCode,
+			Message: server.Error,
+			World:   server.Name,
+		}
+	}
+
+	return info
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/veteran-software/yourddo-api/shared/types"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+var updateGolden = flag.Bool("update", false, "update golden files")
+
+// goldenSnapshot is a fixed snapshot covering every server state and error shape.
+func goldenSnapshot() *snapshot {
+	checkedAt := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	lastKnownAt := time.Date(2024, 1, 1, 11, 55, 0, 0, time.UTC)
+	lastKnownStatus := true
+
+	return &snapshot{
+		Datacenter: types.DatacenterSummary{
+			Name:     "DDO",
+			CachedAt: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		},
+		Servers: []*types.ServerInfo{
+			{
+				Name:       "Argonnessen",
+				CommonName: "Argonnessen",
+				Status:     true,
+				Order:      1,
+				State:      types.StateOnline,
+				Language:   "en",
+				Queue:      &types.QueueInfo{NowServing: 16, LastAssigned: 24, Depth: 8, WaitHint: 2.5},
+				CheckedAt:  checkedAt,
+			},
+			{
+				Name:       "Cannith",
+				CommonName: "Cannith",
+				Order:      2,
+				State:      types.StateOffline,
+				Queue:      &types.QueueInfo{},
+				CheckedAt:  checkedAt,
+			},
+			{
+				Name:            "Ghallanda",
+				CommonName:      "Ghallanda",
+				Order:           3,
+				State:           types.StateError,
+				LastKnownStatus: &lastKnownStatus,
+				LastKnownAt:     &lastKnownAt,
+				Error:           "failed to fetch status: connection refused",
+				ErrorCode:       CodeWorldUnavailable,
+				CheckedAt:       checkedAt,
+			},
+		},
+		Errors: []error{
+			&APIError{
+				Code:  CodeWorldUnavailable,
+				World: "Ghallanda",
+				URL:   "http://ghallanda.test/status",
+				Err:   errors.New("failed to fetch status: connection refused"),
+			},
+		},
+		GeneratedAt: checkedAt,
+	}
+}
+
+func assertGolden(t *testing.T, name string, value any) {
+	t.Helper()
+
+	got, err := json.MarshalIndent(value, "", "  ")
+	if err != nil {
+		t.Fatalf("failed to marshal response: %v", err)
+	}
+	got = append(got, '\n')
+
+	path := filepath.Join("testdata", name)
+	if *updateGolden {
+		if err := os.WriteFile(path, got, 0o644); err != nil {
+			t.Fatalf("failed to update golden file: %v", err)
+		}
+	}
+
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read golden file: %v", err)
+	}
+
+	if !bytes.Equal(got, want) {
+		t.Errorf("%s does not match the response schema; run go test -update if the change is intended\ngot:\n%s\nwant:\n%s", name, got, want)
+	}
+}
+
+// TestV1ResponseGolden serves a fixture through handleRequest and compares the body byte for byte with
+// testdata/v1_response.golden.json, which was captured from the handler as it was before the API was versioned.
+// The golden file must never be regenerated from the current code.
+func TestV1ResponseGolden(t *testing.T) {
+	world := func(name, roles string) *httptest.Server {
+		return newXMLTestServer(fmt.Sprintf("<Status><name>%s</name><allow_billing_role>%s</allow_billing_role></Status>", name, roles))
+	}
+
+	argonnessen := world("Argonnessen", "role1,role2,role3,role4,role5")
+	defer argonnessen.Close()
+
+	cannith := world("Cannith", "")
+	defer cannith.Close()
+
+	datacenterServer := newXMLTestServer(fmt.Sprintf(`<ArrayOfDatacenterStruct><DatacenterStruct><KeyName>DDO</KeyName><Datacenter><datacenter><Datacenter><Worlds>
+<World><Name>Argonnessen</Name><StatusServerUrl>%s</StatusServerUrl><Order>1</Order></World>
+<World><Name>Cannith</Name><StatusServerUrl>%s</StatusServerUrl><Order>2</Order></World>
+</Worlds></Datacenter></datacenter></Datacenter></DatacenterStruct></ArrayOfDatacenterStruct>`, argonnessen.URL, cannith.URL))
+	defer datacenterServer.Close()
+
+	cleanup := setupEnv(t, datacenterServer.URL)
+	defer cleanup()
+
+	want, err := os.ReadFile(filepath.Join("testdata", "v1_response.golden.json"))
+	if err != nil {
+		t.Fatalf("failed to read golden file: %v", err)
+	}
+
+	for _, path := range []string{"/server_status", "/v1/server_status"} {
+		t.Run(path, func(t *testing.T) {
+			resp, err := handleRequest(context.Background(), events.APIGatewayProxyRequest{Path: path})
+			if err != nil {
+				t.Fatalf("handleRequest() error = %v", err)
+			}
+
+			if resp.Body != string(want) {
+				t.Errorf("v1 body changed from the pre-versioning response\ngot:\n%s\nwant:\n%s", resp.Body, want)
+			}
+		})
+	}
+}
+
+func TestBuildV1ResponseKeepsBaselineFields(t *testing.T) {
+	body, err := json.Marshal(buildV1Response(goldenSnapshot()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var response struct {
+		Servers []map[string]any `json:"servers"`
+	}
+	if err := json.Unmarshal(body, &response); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, server := range response.Servers {
+		for key := range server {
+			switch key {
+			case "name", "commonName", "status", "order":
+			default:
+				t.Errorf("v1 server %v has field %q, which the pre-versioning schema did not have", server["name"], key)
+			}
+		}
+	}
+}
+
+// TestBuildV1ResponseFailedWorldGolden pins how the v1 JSON reports a world whose status fetch failed: it stays in
+// servers with status false, and its error is listed in errors. Its state and last known status are left out, as
+// the v1 schema has no fields for them; clients that need them use v2 or the XML and CSV formats.
+func TestBuildV1ResponseFailedWorldGolden(t *testing.T) {
+	assertGolden(t, "v1_failed_world.golden.json", buildV1Response(goldenSnapshot()))
+}
+
+func TestBuildV2ResponseGolden(t *testing.T) {
+	assertGolden(t, "v2_response.golden.json", buildV2Response(goldenSnapshot()))
+}
+
+func TestApiVersionFromPath(t *testing.T) {
+	tests := []struct {
+		name      string
+		path      string
+		want      apiVersion
+		wantOK    bool
+		wantStrip string
+	}{
+		{name: "unversioned", path: "/server_status", want: apiV1, wantOK: true, wantStrip: "/server_status"},
+		{name: "v1", path: "/v1/server_status", want: apiV1, wantOK: true, wantStrip: "/server_status"},
+		{name: "v2", path: "/v2/server_status", want: apiV2, wantOK: true, wantStrip: "/server_status"},
+		{name: "bare v2", path: "/v2", want: apiV2, wantOK: true, wantStrip: "/"},
+		{name: "unknown version", path: "/v9/server_status", wantOK: false, wantStrip: "/server_status"},
+		{name: "not a version", path: "/vault", want: apiV1, wantOK: true, wantStrip: "/vault"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := apiVersionFromPath(tt.path)
+			if ok != tt.wantOK || (ok && got != tt.want) {
+				t.Errorf("apiVersionFromPath(%q) = %v, %v, want %v, %v", tt.path, got, ok, tt.want, tt.wantOK)
+			}
+
+			if stripped := stripVersion(tt.path); stripped != tt.wantStrip {
+				t.Errorf("stripVersion(%q) = %q, want %q", tt.path, stripped, tt.wantStrip)
+			}
+		})
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"github.com/aws/aws-lambda-go/events"
+	"io"
+	"net"
+	"net/http"
+	"time"
+)
+
+// newStandaloneServer returns an HTTP server that runs the Lambda handler outside of AWS, e.g. so Prometheus can
+// scrape /metrics from a long-running process.
+func newStandaloneServer(addr string) *http.Server {
+	return &http.Server{
+		Addr:              addr,
+		Handler:           http.HandlerFunc(serveHTTP),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+}
+
+// serveHTTP adapts a net/http request to an API Gateway proxy request and writes the handler's response back.
+func serveHTTP(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+
+	req := events.APIGatewayProxyRequest{
+		Path:                            r.URL.Path,
+		HTTPMethod:                      r.Method,
+		Headers:                         make(map[string]string, len(r.Header)),
+		MultiValueHeaders:               r.Header,
+		QueryStringParameters:           make(map[string]string),
+		MultiValueQueryStringParameters: r.URL.Query(),
+		Body:                            string(body),
+	}
+
+	for key := range r.Header {
+		req.Headers[key] = r.Header.Get(key)
+	}
+	if r.Host != "" {
+		req.Headers["Host"] = r.Host
+	}
+
+	for key, values := range r.URL.Query() {
+		req.QueryStringParameters[key] = values[0]
+	}
+
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		req.RequestContext.Identity.SourceIP = host
+	}
+
+	resp, err := handleRequest(r.Context(), req)
+	if err != nil {
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	for key, value := range resp.Headers {
+		w.Header().Set(key, value)
+	}
+	for key, values := range resp.MultiValueHeaders {
+		for _, value := range values {
+			w.Header().Add(key, value)
+		}
+	}
+
+	w.WriteHeader(resp.StatusCode)
+	_, _ = io.WriteString(w, resp.Body)
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strings"
+	"syscall"
+)
+
+const defaultMaxRedirects = 3
+
+// defaultUpstreamAllowedHosts are the hosts the game's datacenter and world status servers are published on: the
+// ddo.com names and the Standing Stone Games address range the world status URLs point at.
+const defaultUpstreamAllowedHosts = "*.ddo.com,198.252.160.0/24"
+
+// anyPublicHost is the allowlist entry that opts out of the allowlist, leaving only the address checks.
+const anyPublicHost = "*"
+
+// ErrUpstreamBlocked is wrapped by every error caused by an upstream URL the UpstreamPolicy rejects.
+var ErrUpstreamBlocked = errors.New("upstream URL blocked")
+
+// sharedAddressSpace is the carrier-grade NAT range, which net.IP does not classify as private.
+var sharedAddressSpace = netip.MustParsePrefix("100.64.0.0/10")
+
+// UpstreamPolicy decides which URLs the API may fetch. URLs come from the datacenter document, so a spoofed document
+// must not be able to point fetches at the Lambda's own network, such as the instance metadata endpoint.
+type UpstreamPolicy struct {
+	// AllowedHosts lists exact host names, "*.example.com" suffix patterns and address prefixes such as
+	// "198.51.100.0/24" matching literal IP hosts. "*" allows any host; empty allows none.
+	AllowedHosts []string
+	// AllowPrivate permits loopback, private, link-local and other non-public addresses.
+	AllowPrivate bool
+	MaxRedirects int
+}
+
+// upstreamPolicyFromConfig builds the policy set in the upstream configuration.
+func upstreamPolicyFromConfig(c UpstreamConfig) *UpstreamPolicy {
+	policy := &UpstreamPolicy{AllowPrivate: c.AllowPrivate, MaxRedirects: c.MaxRedirects}
+
+	for _, host := range c.AllowedHosts {
+		if host = strings.ToLower(strings.TrimSpace(host)); host != "" {
+			policy.AllowedHosts = append(policy.AllowedHosts, host)
+		}
+	}
+
+	return policy
+}
+
+var upstreamPolicy *UpstreamPolicy
+
+// CheckURL rejects URLs with a scheme other than http or https, a host outside AllowedHosts, or a literal IP address
+// that is not public.
+func (p *UpstreamPolicy) CheckURL(u *url.URL) error {
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("%w: scheme %q is not allowed", ErrUpstreamBlocked, u.Scheme)
+	}
+
+	host := strings.ToLower(u.Hostname())
+	if host == "" {
+		return fmt.Errorf("%w: URL has no host", ErrUpstreamBlocked)
+	}
+
+	if !p.hostAllowed(host) {
+		return fmt.Errorf("%w: host %q is not in the allowlist", ErrUpstreamBlocked, host)
+	}
+
+	if addr, err := netip.ParseAddr(host); err == nil {
+		return p.CheckAddr(addr)
+	}
+
+	return nil
+}
+
+func (p *UpstreamPolicy) hostAllowed(host string) bool {
+	addr, addrErr := netip.ParseAddr(host)
+
+	for _, pattern := range p.AllowedHosts {
+		if pattern == anyPublicHost {
+			return true
+		}
+
+		if suffix, ok := strings.CutPrefix(pattern, "*"); ok {
+			if strings.HasSuffix(host, suffix) {
+				return true
+			}
+			continue
+		}
+
+		if prefix, err := netip.ParsePrefix(pattern); err == nil {
+			if addrErr == nil && prefix.Contains(addr.Unmap()) {
+				return true
+			}
+			continue
+		}
+
+		if host == pattern {
+			return true
+		}
+	}
+
+	return false
+}
+
+// CheckAddr rejects addresses that are not publicly routable unless AllowPrivate is set.
+func (p *UpstreamPolicy) CheckAddr(addr netip.Addr) error {
+	if p.AllowPrivate {
+		return nil
+	}
+
+	addr = addr.Unmap()
+	if addr.IsLoopback() || addr.IsPrivate() || addr.IsLinkLocalUnicast() || addr.IsLinkLocalMulticast() ||
+		addr.IsInterfaceLocalMulticast() || addr.IsMulticast() || addr.IsUnspecified() || sharedAddressSpace.Contains(addr) {
+		return fmt.Errorf("%w: address %s is not public", ErrUpstreamBlocked, addr)
+	}
+
+	return nil
+}
+
+// dialControl checks the address a connection is about to be made to, after DNS resolution, so a host name that
+// resolves to an internal address is caught as well.
+func (p *UpstreamPolicy) dialControl(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrUpstreamBlocked, err)
+	}
+
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrUpstreamBlocked, err)
+	}
+
+	return p.CheckAddr(addr)
+}
+
+// checkRedirect limits the number of redirects followed and checks every redirect target.
+func (p *UpstreamPolicy) checkRedirect(req *http.Request, via []*http.Request) error {
+	if len(via) > p.MaxRedirects {
+		return fmt.Errorf("%w: stopped after %d redirects", ErrUpstreamBlocked, p.MaxRedirects)
+	}
+
+	return p.CheckURL(req.URL)
+}
+
+// guardedTransport checks every request URL against upstreamPolicy before handing it to the next transport.
+type guardedTransport struct {
+	next http.RoundTripper
+}
+
+func (t guardedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if err := upstreamPolicy.CheckURL(req.URL); err != nil {
+		return nil, err
+	}
+
+	return t.next.RoundTrip(req)
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// usePolicy replaces upstreamPolicy for the rest of the test.
+func usePolicy(t *testing.T, policy *UpstreamPolicy) {
+	previous := upstreamPolicy
+	upstreamPolicy = policy
+	t.Cleanup(func() {
+		upstreamPolicy = previous
+	})
+}
+
+func TestUpstreamPolicyCheckURL(t *testing.T) {
+	open := &UpstreamPolicy{AllowedHosts: []string{anyPublicHost}, MaxRedirects: defaultMaxRedirects}
+	allowlisted := &UpstreamPolicy{AllowedHosts: []string{"gls.ddo.com", "*.ddo.com", "198.252.160.0/24"}, MaxRedirects: defaultMaxRedirects}
+	closed := &UpstreamPolicy{MaxRedirects: defaultMaxRedirects}
+
+	tests := []struct {
+		name    string
+		policy  *UpstreamPolicy
+		url     string
+		wantErr bool
+	}{
+		{name: "public IP", policy: open, url: "http://198.252.160.21/GLS.STG.DataCenterServer/StatusServer.aspx", wantErr: false},
+		{name: "public host", policy: open, url: "https://status.example.com/", wantErr: false},
+		{name: "file scheme", policy: open, url: "file:///etc/passwd", wantErr: true},
+		{name: "gopher scheme", policy: open, url: "gopher://status.example.com/", wantErr: true},
+		{name: "no host", policy: open, url: "http:///status", wantErr: true},
+		{name: "instance metadata", policy: open, url: "http://169.254.169.254/latest/meta-data/", wantErr: true},
+		{name: "ECS metadata", policy: open, url: "http://169.254.170.2/v2/credentials", wantErr: true},
+		{name: "IPv6 instance metadata", policy: open, url: "http://[fd00:ec2::254]/latest/meta-data/", wantErr: true},
+		{name: "loopback", policy: open, url: "http://127.0.0.1:8080/", wantErr: true},
+		{name: "IPv6 loopback", policy: open, url: "http://[::1]/", wantErr: true},
+		{name: "IPv4-mapped loopback", policy: open, url: "http://[::ffff:127.0.0.1]/", wantErr: true},
+		{name: "private network", policy: open, url: "http://10.0.0.5/", wantErr: true},
+		{name: "shared address space", policy: open, url: "http://100.64.1.1/", wantErr: true},
+		{name: "unspecified", policy: open, url: "http://0.0.0.0/", wantErr: true},
+		{name: "allowlisted exact host", policy: allowlisted, url: "http://gls.ddo.com/", wantErr: false},
+		{name: "allowlisted suffix", policy: allowlisted, url: "http://status.ddo.com/", wantErr: false},
+		{name: "host outside allowlist", policy: allowlisted, url: "http://status.example.com/", wantErr: true},
+		{name: "suffix without dot boundary", policy: allowlisted, url: "http://evilddo.com/", wantErr: true},
+		{name: "allowlisted address prefix", policy: allowlisted, url: "http://198.252.160.21/GLS.STG.DataCenterServer/StatusServer.aspx", wantErr: false},
+		{name: "address outside allowlisted prefix", policy: allowlisted, url: "http://198.252.161.21/", wantErr: true},
+		{name: "empty allowlist", policy: closed, url: "http://gls.ddo.com/", wantErr: true},
+		{name: "private allowed", policy: &UpstreamPolicy{AllowedHosts: []string{anyPublicHost}, AllowPrivate: true}, url: "http://127.0.0.1/", wantErr: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u, err := url.Parse(tt.url)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = tt.policy.CheckURL(u)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("CheckURL(%s) error = %v, wantErr %v", tt.url, err, tt.wantErr)
+			}
+			if err != nil && !errors.Is(err, ErrUpstreamBlocked) {
+				t.Errorf("CheckURL(%s) error = %v, want ErrUpstreamBlocked", tt.url, err)
+			}
+		})
+	}
+}
+
+func TestUpstreamPolicyFromConfig(t *testing.T) {
+	policy := upstreamPolicyFromConfig(UpstreamConfig{AllowedHosts: []string{"gls.ddo.com", " *.DDO.com", ""}, AllowPrivate: true, MaxRedirects: 1})
+
+	if strings.Join(policy.AllowedHosts, ",") != "gls.ddo.com,*.ddo.com" {
+		t.Errorf("AllowedHosts = %v", policy.AllowedHosts)
+	}
+	if !policy.AllowPrivate {
+		t.Error("AllowPrivate = false, want true")
+	}
+	if policy.MaxRedirects != 1 {
+		t.Errorf("MaxRedirects = %v, want 1", policy.MaxRedirects)
+	}
+}
+
+func TestUpstreamFetchesAreGuarded(t *testing.T) {
+	usePolicy(t, &UpstreamPolicy{AllowedHosts: []string{anyPublicHost}, MaxRedirects: defaultMaxRedirects})
+
+	tests := []struct {
+		name  string
+		fetch func() error
+	}{
+		{name: "datacenter with file scheme", fetch: func() error {
+			_, err := FetchAndParseDatacenter(context.Background(), "file:///etc/passwd")
+			return err
+		}},
+		{name: "world status on instance metadata", fetch: func() error {
+			_, err := FetchAndParseStatus(context.Background(), "http://169.254.169.254/latest/meta-data/")
+			return err
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.fetch(); !errors.Is(err, ErrUpstreamBlocked) {
+				t.Errorf("fetch error = %v, want ErrUpstreamBlocked", err)
+			}
+		})
+	}
+}
+
+func TestHealthCheckIsGuarded(t *testing.T) {
+	usePolicy(t, &UpstreamPolicy{AllowedHosts: []string{anyPublicHost}, MaxRedirects: defaultMaxRedirects})
+
+	health := checkUpstream(context.Background(), "http://127.0.0.1:1/")
+	if health.Reachable || !strings.Contains(health.Error, ErrUpstreamBlocked.Error()) {
+		t.Errorf("checkUpstream() = %+v, want a blocked error", health)
+	}
+}
+
+func TestUpstreamDialBlocksResolvedPrivateAddresses(t *testing.T) {
+	server := newXMLTestServer(statusResponse)
+	defer server.Close()
+
+	usePolicy(t, &UpstreamPolicy{AllowedHosts: []string{anyPublicHost}, MaxRedirects: defaultMaxRedirects})
+
+	// localhost passes the URL check as a host name and is only caught once it resolves to loopback
+	target := strings.Replace(server.URL, "127.0.0.1", "localhost", 1)
+
+	if _, err := FetchAndParseStatus(context.Background(), target); !errors.Is(err, ErrUpstreamBlocked) {
+		t.Errorf("FetchAndParseStatus(%s) error = %v, want ErrUpstreamBlocked", target, err)
+	}
+}
+
+func TestUpstreamRedirects(t *testing.T) {
+	var hits atomic.Int32
+	loop := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		http.Redirect(w, r, r.URL.String(), http.StatusFound)
+	}))
+	defer loop.Close()
+
+	escape := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "http://internal.example/secret", http.StatusFound)
+	}))
+	defer escape.Close()
+
+	tests := []struct {
+		name     string
+		url      string
+		wantHits int32
+	}{
+		{name: "redirect limit", url: loop.URL, wantHits: 3},
+		{name: "redirect outside allowlist", url: escape.URL},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hits.Store(0)
+			usePolicy(t, &UpstreamPolicy{AllowedHosts: []string{"127.0.0.1"}, AllowPrivate: true, MaxRedirects: 2})
+
+			_, err := FetchAndParseStatus(context.Background(), tt.url)
+			if !errors.Is(err, ErrUpstreamBlocked) {
+				t.Errorf("FetchAndParseStatus() error = %v, want ErrUpstreamBlocked", err)
+			}
+			if got := hits.Load(); got != tt.wantHits {
+				t.Errorf("hits = %d, want %d", got, tt.wantHits)
+			}
+		})
+	}
+}
@@ -1,11 +1,13 @@
 package main
 
 import (
+	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"github.com/veteran-software/yourddo-api/shared/types"
-	"io"
 	"net/http"
+	"runtime/debug"
 	"sync"
 	"time"
 )
@@ -14,15 +16,20 @@ type WorkerPool struct {
 	workers    int
 	maxRetries int
 	client     *http.Client
+	hedger     *Hedger
 }
 
+// NewWorkerPool returns a pool running at most workers concurrent fetches over the shared upstream client.
 func NewWorkerPool(workers, maxRetries int) *WorkerPool {
+	if workers < 1 {
+		workers = 1
+	}
+
 	return &WorkerPool{
 		workers:    workers,
 		maxRetries: maxRetries,
-		client: &http.Client{
-			Timeout: 10 * time.Second,
-		},
+		client:     upstreamClient,
+		hedger:     hedger,
 	}
 }
 
@@ -37,12 +44,14 @@ func (p *WorkerPool) ProcessURLs(ctx context.Context, urls []string) chan types.
 		go func() {
 			defer wg.Done()
 			for url := range jobs {
-				status, err := FetchAndParseStatus(url)
+				start := time.Now()
+				status, err := p.fetchWithRetries(ctx, url)
 				select {
 				case results <- types.WorkerResult{
-					URL:    url,
-					Status: status,
-					Error:  err,
+					URL:      url,
+					Status:   status,
+					Error:    err,
+					Duration: time.Since(start),
 				}:
 				case <-ctx.Done():
 					return
@@ -71,7 +80,34 @@ func (p *WorkerPool) ProcessURLs(ctx context.Context, urls []string) chan types.
 	return results
 }
 
-func (p *WorkerPool) fetchStatus(ctx context.Context, url string) (*types.Status, error) {
+// fetchWithRetries fetches a world's status, retrying failed fetches up to maxRetries times with exponential backoff.
+// Blocked URLs, oversized responses and documents that do not parse fail the same way again, so they are not retried.
+func (p *WorkerPool) fetchWithRetries(ctx context.Context, url string) (*types.Status, error) {
+	backoff := cfg.Upstream.RetryBackoff.Duration
+
+	for attempt := 0; ; attempt++ {
+		status, err := p.hedger.Fetch(ctx, url, fetchStatusSafely)
+		if err == nil || attempt >= p.maxRetries || !retryable(err) {
+			return status, err
+		}
+
+		loggerFromContext(ctx).Debug("retrying world status fetch", "url", url, "attempt", attempt+1, "error", err)
+
+		select {
+		case <-time.After(backoff << attempt):
+		case <-ctx.Done():
+			return nil, err
+		}
+	}
+}
+
+// retryable reports whether a failed fetch may succeed when tried again.
+func retryable(err error) bool {
+	var parseErr *parseError
+	return !errors.As(err, &parseErr) && !errors.Is(err, ErrUpstreamBlocked) && !errors.Is(err, ErrUpstreamTooLarge)
+}
+
+func (p *WorkerPool) fetchStatus(ctx context.Context, url string) (status *types.Status, err error) {
 	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
 		return nil, fmt.Errorf("error creating request: %w", err)
@@ -83,16 +119,29 @@ func (p *WorkerPool) fetchStatus(ctx context.Context, url string) (*types.Status
 	if err != nil {
 		return nil, fmt.Errorf("error fetching status: %w", err)
 	}
-	defer func(Body io.ReadCloser) {
-		err := Body.Close()
-		if err != nil {
-			panic(err)
-		}
-	}(resp.Body)
+	defer closeBody(ctx, resp.Body, url, &err)
 
 	if resp.StatusCode != http.StatusOK {
 		return nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
 	}
 
-	return ParseStatusXML(resp.Body)
+	body, err := readUpstreamBody(resp, upstreamLimits.MaxBodyBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	return ParseStatusXML(bytes.NewReader(body))
+}
+
+// fetchStatusSafely calls FetchAndParseStatus and turns a panic into an error, so one bad world cannot crash the
+// whole response.
+func fetchStatusSafely(ctx context.Context, url string) (status *types.Status, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			loggerFromContext(ctx).Error("recovered from panic while fetching world status", "url", url, "panic", r, "stack", string(debug.Stack()))
+			status, err = nil, fmt.Errorf("panic while fetching status: %v", r)
+		}
+	}()
+
+	return FetchAndParseStatus(ctx, url)
 }
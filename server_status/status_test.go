@@ -2,8 +2,11 @@ package main
 
 import (
 	"context"
+	"fmt"
+	"github.com/veteran-software/yourddo-api/shared/types"
 	"net/http"
 	"net/http/httptest"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -22,6 +25,10 @@ func TestNewWorkerPool(t *testing.T) {
 	if pool.client == nil {
 		t.Error("NewWorkerPool() client is nil")
 	}
+
+	if got := NewWorkerPool(0, 0).workers; got != 1 {
+		t.Errorf("NewWorkerPool(0) workers = %v, want 1", got)
+	}
 }
 
 func TestWorkerPoolProcessURLs(t *testing.T) {
@@ -143,3 +150,127 @@ func TestWorkerPoolFetchStatus(t *testing.T) {
 		})
 	}
 }
+
+func TestWorkerPoolFetchWithRetries(t *testing.T) {
+	useConfig(t, func(c *Config) {
+		c.Upstream.RetryBackoff = Duration{time.Millisecond}
+	})
+
+	tests := []struct {
+		name         string
+		failures     int32
+		body         string
+		retries      int
+		wantErr      bool
+		wantRequests int32
+	}{
+		{name: "no retries", failures: 1, body: statusResponse, retries: 0, wantErr: true, wantRequests: 1},
+		{name: "recovers after failures", failures: 2, body: statusResponse, retries: 2, wantRequests: 3},
+		{name: "gives up after retries", failures: 5, body: statusResponse, retries: 2, wantErr: true, wantRequests: 3},
+		{name: "parse errors are not retried", body: "<Status>", retries: 2, wantErr: true, wantRequests: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests atomic.Int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if requests.Add(1) <= tt.failures {
+					w.WriteHeader(http.StatusServiceUnavailable)
+					return
+				}
+				w.Header().Set(contentTypeKey, contentTypeValue)
+				_, _ = w.Write([]byte(tt.body))
+			}))
+			defer server.Close()
+
+			status, err := NewWorkerPool(1, tt.retries).fetchWithRetries(context.Background(), server.URL)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("fetchWithRetries() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && status == nil {
+				t.Error("fetchWithRetries() returned nil status for a successful fetch")
+			}
+			if got := requests.Load(); got != tt.wantRequests {
+				t.Errorf("requests = %d, want %d", got, tt.wantRequests)
+			}
+		})
+	}
+}
+
+func TestWorkerPoolRecoversFromPanics(t *testing.T) {
+	server := newXMLTestServer(statusResponse)
+	defer server.Close()
+
+	useUpstreamTransport(t, roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		if req.URL.Host == "panic.example" {
+			panic("transport exploded")
+		}
+		return http.DefaultTransport.RoundTrip(req)
+	}))
+
+	pool := NewWorkerPool(2, 0)
+	results := pool.ProcessURLs(context.Background(), []string{server.URL, "http://panic.example"})
+
+	got := make(map[string]types.WorkerResult)
+	for result := range results {
+		got[result.URL] = result
+	}
+
+	if len(got) != 2 {
+		t.Fatalf("got %d results, want 2", len(got))
+	}
+	if result := got[server.URL]; result.Error != nil || result.Status == nil {
+		t.Errorf("healthy world result = %+v, want a status", result)
+	}
+	if result := got["http://panic.example"]; result.Error == nil || result.Status != nil {
+		t.Errorf("panicking world result = %+v, want an error", result)
+	}
+}
+
+// BenchmarkWorkerPoolProcessURLs polls a farm of worlds served by a single status host, as in production where every
+// StatusServerUrl differs only by its ?s= parameter, with each answer taking a fixed latency. It runs at several
+// worker limits, each with the per-host connection cap derived from it and with the former fixed cap of 4.
+func BenchmarkWorkerPoolProcessURLs(b *testing.B) {
+	const (
+		worlds  = 12
+		latency = 20 * time.Millisecond
+	)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(latency)
+		w.Header().Set(contentTypeKey, contentTypeValue)
+		_, _ = w.Write([]byte(statusResponse))
+	}))
+	b.Cleanup(server.Close)
+
+	urls := make([]string, 0, worlds)
+	for i := 0; i < worlds; i++ {
+		urls = append(urls, fmt.Sprintf("%s/?s=%d", server.URL, i))
+	}
+
+	for _, workers := range []int{1, 4, 8, 16} {
+		caps := []int{4}
+		if derived := upstreamConnsPerHost(&Config{WorkerConcurrency: workers}); derived != 4 {
+			caps = append(caps, derived)
+		}
+
+		for _, connsPerHost := range caps {
+			b.Run(fmt.Sprintf("workers=%d/conns=%d", workers, connsPerHost), func(b *testing.B) {
+				previous := upstreamClient
+				upstreamClient = &http.Client{Transport: newUpstreamTransport(connsPerHost, upstreamLimits)}
+				b.Cleanup(func() {
+					upstreamClient = previous
+				})
+
+				pool := NewWorkerPool(workers, 0)
+				for i := 0; i < b.N; i++ {
+					for result := range pool.ProcessURLs(context.Background(), urls) {
+						if result.Error != nil {
+							b.Fatal(result.Error)
+						}
+					}
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/aws/aws-lambda-go/events"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+	"strings"
+)
+
+const (
+	tracerName         = "github.com/veteran-software/yourddo-api/server_status"
+	defaultServiceName = "yourddo-server-status"
+)
+
+// tracer resolves through the global provider, so spans are no-ops until initTracing installs an exporter.
+var tracer = otel.Tracer(tracerName)
+
+// tracerProvider is set when tracing is enabled, so spans can be flushed before Lambda freezes the container.
+var tracerProvider *sdktrace.TracerProvider
+
+// initTracing configures the exporter selected by OTEL_TRACES_EXPORTER: "otlp" sends spans over OTLP/HTTP to
+// OTEL_EXPORTER_OTLP_ENDPOINT, "console" writes them to stdout for local testing, and anything else disables tracing.
+func initTracing(ctx context.Context) error {
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	var (
+		exporter sdktrace.SpanExporter
+		err      error
+	)
+
+	switch strings.ToLower(cfg.Features.TracesExporter) {
+	case "otlp":
+		exporter, err = otlptracehttp.New(ctx)
+	case "console", "stdout":
+		exporter, err = stdouttrace.New(stdouttrace.WithPrettyPrint())
+	default:
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("error creating trace exporter: %w", err)
+	}
+
+	serviceName := cfg.Features.ServiceName
+	if serviceName == "" {
+		serviceName = defaultServiceName
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewSchemaless(attribute.String("service.name", serviceName)))
+	if err != nil {
+		return fmt.Errorf("error creating trace resource: %w", err)
+	}
+
+	tracerProvider = sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+	)
+	otel.SetTracerProvider(tracerProvider)
+
+	return nil
+}
+
+// flushTracing exports buffered spans. Inside Lambda this must happen before the invocation returns.
+func flushTracing(ctx context.Context) {
+	if tracerProvider == nil {
+		return
+	}
+
+	if err := tracerProvider.ForceFlush(ctx); err != nil {
+		loggerFromContext(ctx).Warn("failed to flush spans", "error", err)
+	}
+}
+
+// extractTraceContext continues a trace started by the caller, if the request carries a traceparent header.
+func extractTraceContext(ctx context.Context, req events.APIGatewayProxyRequest) context.Context {
+	carrier := propagation.MapCarrier{}
+	for key, value := range req.Headers {
+		carrier[strings.ToLower(key)] = value
+	}
+
+	return otel.GetTextMapPropagator().Extract(ctx, carrier)
+}
+
+// injectTraceHeaders adds the traceparent and X-Trace-Id of the current span to a response.
+func injectTraceHeaders(ctx context.Context, resp *events.APIGatewayProxyResponse) {
+	spanContext := trace.SpanContextFromContext(ctx)
+	if !spanContext.IsValid() {
+		return
+	}
+
+	if resp.Headers == nil {
+		resp.Headers = make(map[string]string)
+	}
+
+	carrier := propagation.MapCarrier{}
+	otel.GetTextMapPropagator().Inject(ctx, carrier)
+	for key, value := range carrier {
+		resp.Headers[key] = value
+	}
+
+	resp.Headers["X-Trace-Id"] = spanContext.TraceID().String()
+}
+
+// endSpan records err on span, if any, and ends it.
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+
+	span.End()
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/aws/aws-lambda-go/events"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"testing"
+)
+
+// testSpanExporter receives all spans to an in-memory exporter. The global provider can only be delegated once, so
+// every test in the package shares it.
+var testSpanExporter = func() *tracetest.InMemoryExporter {
+	exporter := tracetest.NewInMemoryExporter()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	return exporter
+}()
+
+func TestHandleRequestTracing(t *testing.T) {
+	statusServer := newXMLTestServer(statusResponse)
+	defer statusServer.Close()
+
+	datacenterServer := newXMLTestServer(fmt.Sprintf(dcResponse, statusServer.URL))
+	defer datacenterServer.Close()
+
+	cleanup := setupEnv(t, datacenterServer.URL)
+	defer cleanup()
+
+	testSpanExporter.Reset()
+
+	const traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	got, err := handleRequest(context.Background(), events.APIGatewayProxyRequest{
+		Path:    "/server_status",
+		Headers: map[string]string{"Traceparent": "00-" + traceID + "-00f067aa0ba902b7-01"},
+	})
+	if err != nil {
+		t.Fatalf("handleRequest() error = %v", err)
+	}
+
+	if got.Headers["X-Trace-Id"] != traceID {
+		t.Errorf("X-Trace-Id = %q, want the caller's trace %q", got.Headers["X-Trace-Id"], traceID)
+	}
+	if got.Headers["traceparent"] == "" {
+		t.Error("response is missing a traceparent header")
+	}
+
+	spans := map[string]int{}
+	for _, span := range testSpanExporter.GetSpans() {
+		if span.SpanContext.TraceID().String() != traceID {
+			t.Errorf("span %q is not part of the caller's trace", span.Name)
+		}
+		spans[span.Name]++
+	}
+
+	for _, name := range []string{"handleRequest", "fetch datacenter", "parse datacenter", "fetch world status", "parse world status"} {
+		if spans[name] != 1 {
+			t.Errorf("span %q recorded %d times, want 1 (spans: %v)", name, spans[name], spans)
+		}
+	}
+	if spans["HTTP GET"] != 2 {
+		t.Errorf("HTTP client spans = %d, want 2 (spans: %v)", spans["HTTP GET"], spans)
+	}
+}
+
+func TestFetchSpanRecordsErrors(t *testing.T) {
+	testSpanExporter.Reset()
+
+	if _, err := FetchAndParseStatus(context.Background(), invalidUrl); err == nil {
+		t.Fatal("FetchAndParseStatus() succeeded for an invalid URL")
+	}
+
+	for _, span := range testSpanExporter.GetSpans() {
+		if span.Name == "fetch world status" {
+			if len(span.Events) == 0 || span.Status.Code.String() != "Error" {
+				t.Errorf("fetch span did not record the error: status %v, events %v", span.Status, span.Events)
+			}
+			return
+		}
+	}
+
+	t.Error("no fetch world status span recorded")
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"io"
+	"net"
+	"net/http"
+	"syscall"
+	"time"
+)
+
+// Defaults chosen with BenchmarkWorkerPoolProcessURLs: a poll takes one upstream round trip per batch of workers, so
+// the worker limit covers every live world in a single batch with headroom for new ones. Every world's status is
+// served by the same host, so the per-host connection cap is derived from the worker limit rather than set apart.
+const (
+	defaultWorkerConcurrency = 16
+	upstreamIdleConnTimeout  = 90 * time.Second
+)
+
+// Upstream limits. Datacenter and status documents are a few kilobytes, so the body limit leaves plenty of room.
+const (
+	defaultUpstreamTimeoutSeconds       = 10
+	defaultUpstreamHeaderTimeoutSeconds = 5
+	defaultUpstreamMaxBodyBytes         = 1 << 20
+	defaultRetryBackoff                 = 200 * time.Millisecond
+	maxUpstreamRetries                  = 5
+)
+
+// ErrUpstreamTooLarge is wrapped by errors for upstream responses larger than the configured body limit.
+var ErrUpstreamTooLarge = errors.New("upstream response too large")
+
+// UpstreamLimits bounds every upstream call. Timeout covers the whole call including reading the body, so a server
+// trickling its response cannot hold a worker past it; HeaderTimeout covers connecting and waiting for headers.
+type UpstreamLimits struct {
+	Timeout       time.Duration
+	HeaderTimeout time.Duration
+	MaxBodyBytes  int64
+}
+
+// upstreamLimitsFromConfig returns the limits set in the upstream configuration.
+func upstreamLimitsFromConfig(c UpstreamConfig) UpstreamLimits {
+	return UpstreamLimits{
+		Timeout:       c.Timeout.Duration,
+		HeaderTimeout: c.HeaderTimeout.Duration,
+		MaxBodyBytes:  c.MaxBodyBytes,
+	}
+}
+
+var upstreamLimits UpstreamLimits
+
+// newUpstreamTransport returns a pooled transport that keeps connections alive between polls and caps the
+// connections opened to each host. Every connection is checked against upstreamPolicy once its address is resolved.
+func newUpstreamTransport(connsPerHost int, limits UpstreamLimits) *http.Transport {
+	dialer := &net.Dialer{
+		Timeout:   limits.HeaderTimeout,
+		KeepAlive: 30 * time.Second,
+		Control: func(network, address string, c syscall.RawConn) error {
+			return upstreamPolicy.dialControl(network, address, c)
+		},
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	// A proxy would make the dialer check the proxy's address instead of the upstream's, so fetches always go direct
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+	transport.TLSHandshakeTimeout = limits.HeaderTimeout
+	transport.ResponseHeaderTimeout = limits.HeaderTimeout
+	transport.MaxResponseHeaderBytes = 64 << 10
+	transport.MaxIdleConns = 100
+	transport.MaxIdleConnsPerHost = connsPerHost
+	transport.MaxConnsPerHost = connsPerHost
+	transport.IdleConnTimeout = upstreamIdleConnTimeout
+
+	return transport
+}
+
+// upstreamConnsPerHost returns the connections that may be open to one upstream host: the configured cap, or one per
+// worker, and one more for each worker's hedged request when hedging is on.
+func upstreamConnsPerHost(c *Config) int {
+	if c.Upstream.MaxConnsPerHost > 0 {
+		return c.Upstream.MaxConnsPerHost
+	}
+
+	if newHedgerFromConfig(c.Hedge) != nil {
+		return 2 * c.WorkerConcurrency
+	}
+
+	return c.WorkerConcurrency
+}
+
+// newUpstreamClient returns the instrumented, policy-checked client used for every upstream call.
+func newUpstreamClient(limits UpstreamLimits) *http.Client {
+	return &http.Client{
+		Timeout:   limits.Timeout,
+		Transport: otelhttp.NewTransport(guardedTransport{next: newUpstreamTransport(upstreamConnsPerHost(cfg), limits)}),
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return upstreamPolicy.checkRedirect(req, via)
+		},
+	}
+}
+
+// upstreamClient is used for datacenter and status fetches. It lives for the whole container, so warm invocations
+// reuse its connections.
+var upstreamClient *http.Client
+
+// readUpstreamBody reads a whole response body, failing with ErrUpstreamTooLarge past limit bytes.
+func readUpstreamBody(resp *http.Response, limit int64) ([]byte, error) {
+	if resp.ContentLength > limit {
+		return nil, fmt.Errorf("%w: %d bytes exceeds the %d byte limit", ErrUpstreamTooLarge, resp.ContentLength, limit)
+	}
+
+	content, err := io.ReadAll(io.LimitReader(resp.Body, limit+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response body: %w", err)
+	}
+
+	if int64(len(content)) > limit {
+		return nil, fmt.Errorf("%w: body exceeds the %d byte limit", ErrUpstreamTooLarge, limit)
+	}
+
+	return content, nil
+}
+
+// isTimeout reports whether err was caused by an upstream call running out of time.
+func isTimeout(err error) bool {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestUpstreamLimitsFromConfig(t *testing.T) {
+	got := upstreamLimitsFromConfig(UpstreamConfig{Timeout: Duration{4 * time.Second}, HeaderTimeout: Duration{time.Second}, MaxBodyBytes: 512})
+
+	if want := (UpstreamLimits{Timeout: 4 * time.Second, HeaderTimeout: time.Second, MaxBodyBytes: 512}); got != want {
+		t.Errorf("upstreamLimitsFromConfig() = %+v, want %+v", got, want)
+	}
+}
+
+func TestUpstreamConnsPerHost(t *testing.T) {
+	tests := []struct {
+		name string
+		c    Config
+		want int
+	}{
+		{name: "one per worker", c: Config{WorkerConcurrency: 16}, want: 16},
+		{name: "room for hedged requests", c: Config{WorkerConcurrency: 16, Hedge: HedgeConfig{Percentile: 95}}, want: 32},
+		{name: "configured", c: Config{WorkerConcurrency: 16, Upstream: UpstreamConfig{MaxConnsPerHost: 20}}, want: 20},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := upstreamConnsPerHost(&tt.c); got != tt.want {
+				t.Errorf("upstreamConnsPerHost() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewUpstreamTransport(t *testing.T) {
+	transport := newUpstreamTransport(3, upstreamLimits)
+
+	if transport.MaxConnsPerHost != 3 {
+		t.Errorf("MaxConnsPerHost = %v, want 3", transport.MaxConnsPerHost)
+	}
+	if transport.MaxIdleConnsPerHost != 3 {
+		t.Errorf("MaxIdleConnsPerHost = %v, want 3", transport.MaxIdleConnsPerHost)
+	}
+	if transport.DisableKeepAlives {
+		t.Error("DisableKeepAlives = true, want keep-alives enabled")
+	}
+	if transport.IdleConnTimeout != upstreamIdleConnTimeout {
+		t.Errorf("IdleConnTimeout = %v, want %v", transport.IdleConnTimeout, upstreamIdleConnTimeout)
+	}
+	if transport.Proxy != nil {
+		t.Error("Proxy is set, want fetches to dial the upstream directly")
+	}
+}
+
+func TestReadUpstreamBody(t *testing.T) {
+	tests := []struct {
+		name          string
+		body          string
+		contentLength int64
+		wantErr       error
+	}{
+		{name: "within limit", body: "<Status/>", contentLength: 9},
+		{name: "declared length over limit", body: "", contentLength: 1 << 30, wantErr: ErrUpstreamTooLarge},
+		{name: "unknown length over limit", body: strings.Repeat("x", 17), contentLength: -1, wantErr: ErrUpstreamTooLarge},
+		{name: "exactly the limit", body: strings.Repeat("x", 16), contentLength: -1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := &http.Response{Body: io.NopCloser(strings.NewReader(tt.body)), ContentLength: tt.contentLength}
+
+			got, err := readUpstreamBody(resp, 16)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("readUpstreamBody() error = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && string(got) != tt.body {
+				t.Errorf("readUpstreamBody() = %q, want %q", got, tt.body)
+			}
+		})
+	}
+}
+
+// useUpstreamLimits routes upstream fetches through a client with the given limits for the rest of the test.
+func useUpstreamLimits(t *testing.T, limits UpstreamLimits) {
+	previousLimits, previousClient := upstreamLimits, upstreamClient
+	upstreamLimits, upstreamClient = limits, newUpstreamClient(limits)
+	t.Cleanup(func() {
+		upstreamLimits, upstreamClient = previousLimits, previousClient
+	})
+}
+
+func TestUpstreamLimits(t *testing.T) {
+	slowHeaders := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(5 * time.Second):
+		case <-r.Context().Done():
+		}
+	}))
+	defer slowHeaders.Close()
+
+	// Answers at once but trickles the body a byte at a time, slow-loris style
+	trickle := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(contentTypeKey, contentTypeValue)
+		w.WriteHeader(http.StatusOK)
+		for i := 0; i < 100; i++ {
+			_, _ = w.Write([]byte(" "))
+			w.(http.Flusher).Flush()
+			select {
+			case <-time.After(50 * time.Millisecond):
+			case <-r.Context().Done():
+				return
+			}
+		}
+	}))
+	defer trickle.Close()
+
+	huge := newXMLTestServer(strings.Repeat(" ", 4096) + statusResponse)
+	defer huge.Close()
+
+	normal := newXMLTestServer(statusResponse)
+	defer normal.Close()
+
+	datacenter := newXMLTestServer(fmt.Sprintf(dcResponse, normal.URL) + strings.Repeat(" ", 4096))
+	defer datacenter.Close()
+
+	fetchWorld := func(url string) func() (string, error) {
+		return func() (string, error) {
+			_, err := FetchAndParseStatus(context.Background(), url)
+			return worldErrorCode(err), err
+		}
+	}
+
+	tests := []struct {
+		name     string
+		fetch    func() (string, error)
+		wantErr  bool
+		wantCode string
+	}{
+		{name: "within limits", fetch: fetchWorld(normal.URL), wantErr: false},
+		{name: "slow headers", fetch: fetchWorld(slowHeaders.URL), wantErr: true, wantCode: CodeWorldTimeout},
+		{name: "trickled body", fetch: fetchWorld(trickle.URL), wantErr: true, wantCode: CodeWorldTimeout},
+		{name: "oversized world body", fetch: fetchWorld(huge.URL), wantErr: true, wantCode: CodeWorldTooLarge},
+		{
+			name: "oversized datacenter body",
+			fetch: func() (string, error) {
+				_, err := FetchAndParseDatacenter(context.Background(), datacenter.URL)
+				return datacenterErrorCode(err), err
+			},
+			wantErr:  true,
+			wantCode: CodeDatacenterTooLarge,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useUpstreamLimits(t, UpstreamLimits{Timeout: 500 * time.Millisecond, HeaderTimeout: 200 * time.Millisecond, MaxBodyBytes: 2048})
+
+			start := time.Now()
+			code, err := tt.fetch()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("fetch error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil && code != tt.wantCode {
+				t.Errorf("error code = %v, want %v (error: %v)", code, tt.wantCode, err)
+			}
+			if elapsed := time.Since(start); elapsed > 2*time.Second {
+				t.Errorf("fetch took %v, want it cut off by the limits", elapsed)
+			}
+		})
+	}
+}
@@ -0,0 +1,35 @@
+package types
+
+import "time"
+
+// Health statuses. HealthAPIError means one of the API's own dependencies is failing; HealthUpstreamDown means the API
+// works but the game's servers cannot be reached.
+const (
+	HealthOK           = "ok"
+	HealthUpstreamDown = "upstream_down"
+	HealthAPIError     = "api_error"
+)
+
+type HealthResponse struct {
+	Status                string             `json:"status"`
+	Version               string             `json:"version"`
+	Dependencies          []DependencyHealth `json:"dependencies"`
+	CacheAgeSeconds       *float64           `json:"cacheAgeSeconds,omitempty"`
+	LastDatacenterSuccess *time.Time         `json:"lastDatacenterSuccess,omitempty"`
+	Upstream              UpstreamHealth     `json:"upstream"`
+	CheckedAt             time.Time          `json:"checkedAt"`
+}
+
+// DependencyHealth reports one of the API's own dependencies: its API keys or its Redis server.
+type DependencyHealth struct {
+	Name      string `json:"name"`
+	OK        bool   `json:"ok"`
+	LatencyMs int64  `json:"latencyMs"`
+	Error     string `json:"error,omitempty"`
+}
+
+type UpstreamHealth struct {
+	Reachable bool   `json:"reachable"`
+	LatencyMs int64  `json:"latencyMs"`
+	Error     string `json:"error,omitempty"`
+}
@@ -11,16 +11,46 @@ type Response struct {
 }
 
 type WorkerResult struct {
-	URL    string
-	Status *Status
-	Error  error
+	URL      string
+	Status   *Status
+	Error    error
+	Duration time.Duration
 }
 
+// ServerState describes what is known about a world after a status poll
+type ServerState string
+
+const (
+	StateOnline  ServerState = "online"
+	StateOffline ServerState = "offline"
+	StateUnknown ServerState = "unknown"
+	StateError   ServerState = "error"
+)
+
 type ServerInfo struct {
-	Name       string `json:"name"`
-	CommonName string `json:"commonName"`
-	Status     bool   `json:"status"`
-	Order      int    `json:"order"`
+	Name       string `json:"name" xml:"name"`
+	CommonName string `json:"commonName" xml:"commonName"`
+	Status     bool   `json:"status" xml:"status"`
+	Order      int    `json:"order" xml:"order"`
+
+	// Fields below are left out of the v1 JSON, which must stay as it was before versioning, but appear in the other
+	// v1 formats and in v2
+	State           ServerState `json:"-" xml:"state"`
+	LastKnownStatus *bool       `json:"-" xml:"lastKnownStatus,omitempty"`
+	LastKnownAt     *time.Time  `json:"-" xml:"lastKnownAt,omitempty"`
+	Error           string      `json:"-" xml:"error,omitempty"`
+	DisplayName     string      `json:"-" xml:"displayName,omitempty"`
+
+	// Fields below are only exposed through the v2 schema
+	Language  string      `json:"-" xml:"-"`
+	Queue     *QueueInfo  `json:"-" xml:"-"`
+	CheckedAt time.Time   `json:"-" xml:"-"`
+	ErrorCode string      `json:"-" xml:"-"`
+	Tags      []string    `json:"-" xml:"-"`
+	Links     []WorldLink `json:"-" xml:"-"`
+
+	// FetchDuration is only reported through metrics
+	FetchDuration time.Duration `json:"-" xml:"-"`
 }
 
 type Status struct {
@@ -0,0 +1,64 @@
+package types
+
+import "time"
+
+// ResponseV2 is the body returned by the /v2 API. Unlike Response it carries the datacenter the worlds were read from,
+// per-world queue data and timestamps, and structured errors.
+type ResponseV2 struct {
+	Datacenter  DatacenterSummary `json:"datacenter"`
+	Servers     []*ServerInfoV2   `json:"servers"`
+	Errors      []ErrorInfo       `json:"errors"`
+	GeneratedAt time.Time         `json:"generatedAt"`
+}
+
+// DatacenterSummary describes the datacenter document the worlds were read from. Stale is set when every datacenter
+// endpoint failed and the last good document was used instead; AgeSeconds is the time since the document's CachedAt.
+type DatacenterSummary struct {
+	Name       string    `json:"name"`
+	CachedAt   time.Time `json:"cachedAt"`
+	Stale      bool      `json:"stale"`
+	AgeSeconds *float64  `json:"ageSeconds,omitempty"`
+}
+
+type ServerInfoV2 struct {
+	Name        string         `json:"name"`
+	CommonName  string         `json:"commonName"`
+	DisplayName string         `json:"displayName,omitempty"`
+	State       ServerState    `json:"state"`
+	Order       int            `json:"order"`
+	Language    string         `json:"language,omitempty"`
+	Tags        []string       `json:"tags,omitempty"`
+	Links       []WorldLink    `json:"links,omitempty"`
+	Queue       *QueueInfo     `json:"queue,omitempty"`
+	CheckedAt   time.Time      `json:"checkedAt"`
+	LastKnown   *LastKnownInfo `json:"lastKnown,omitempty"`
+	Error       *ErrorInfo     `json:"error,omitempty"`
+}
+
+// WorldLink is a link attached to a world by the world overrides, such as its forum thread or wiki page
+type WorldLink struct {
+	Title string `json:"title"`
+	URL   string `json:"url"`
+}
+
+// QueueInfo is the login queue of a world as reported by its status server
+type QueueInfo struct {
+	NowServing   int64   `json:"nowServing"`
+	LastAssigned int64   `json:"lastAssigned"`
+	Depth        int64   `json:"depth"`
+	WaitHint     float64 `json:"waitHint"`
+	Full         bool    `json:"full"`
+}
+
+type LastKnownInfo struct {
+	State ServerState `json:"state"`
+	At    time.Time   `json:"at"`
+}
+
+// ErrorInfo is a machine-readable error, optionally tied to the world it occurred on
+type ErrorInfo struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	World   string `json:"world,omitempty"`
+	URL     string `json:"url,omitempty"`
+}